@@ -0,0 +1,26 @@
+// Package collector exposes the metrics of the exporter as a
+// prometheus.Collector, so that they can be registered with the registry of
+// another program instead of being served by the standalone exporter.
+package collector
+
+import (
+	"github.com/1azunna/dependency-track-exporter/internal/exporter"
+)
+
+// Namespace is the default namespace of the collected metrics
+const Namespace = exporter.Namespace
+
+// Collectors are the metric groups an Exporter can be limited to with its
+// Collectors field
+var Collectors = exporter.Collectors
+
+type (
+	// Collector collects the metrics of Exporter from Dependency-Track on
+	// every scrape
+	Collector = exporter.Collector
+	// Exporter holds the configuration of the collection, such as the client
+	// of Dependency-Track and the projects to collect
+	Exporter = exporter.Exporter
+	// CollectorStatus records the outcome of every collector run by Exporter
+	CollectorStatus = exporter.CollectorStatus
+)
@@ -0,0 +1,86 @@
+package collector_test
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dtrack "github.com/DependencyTrack/client-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/1azunna/dependency-track-exporter/collector"
+)
+
+func TestCollector(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	mux.HandleFunc("/api/v1/metrics/portfolio/current", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dtrack.PortfolioMetrics{InheritedRiskScore: 42})
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&collector.Collector{
+		Exporter: &collector.Exporter{
+			Client:     client,
+			Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+			Collectors: []string{"portfolio"},
+		},
+	})
+
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("unexpected error gathering metrics: %s", err)
+	}
+
+	var found bool
+	for _, mf := range mfs {
+		if mf.GetName() != collector.Namespace+"_portfolio_inherited_risk_score" {
+			continue
+		}
+		found = true
+		if got := mf.GetMetric()[0].GetGauge().GetValue(); got != 42 {
+			t.Errorf("unexpected inherited risk score: got %v, want %v", got, 42)
+		}
+	}
+	if !found {
+		t.Errorf("expected dependency_track_portfolio_inherited_risk_score to be collected")
+	}
+}
+
+func ExampleCollector() {
+	client, err := dtrack.NewClient("https://dtrack.example.com", dtrack.WithAPIKey("api-key"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&collector.Collector{
+		Exporter: &collector.Exporter{
+			Client:     client,
+			Logger:     slog.Default(),
+			Collectors: []string{"portfolio", "project"},
+		},
+	})
+
+	http.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	log.Fatal(http.ListenAndServe(":9916", nil))
+}
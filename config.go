@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kingpin/v2"
+	"go.yaml.in/yaml/v2"
+)
+
+const configFileFlag = "config.file"
+
+// configFilePath returns the value of --config.file in args, without
+// otherwise parsing them
+func configFilePath(app *kingpin.Application, args []string) string {
+	pc, err := app.ParseContext(args)
+	if err != nil {
+		return ""
+	}
+	for _, element := range pc.Elements {
+		if f, ok := element.Clause.(*kingpin.FlagClause); ok && f.Model().Name == configFileFlag && element.Value != nil {
+			return *element.Value
+		}
+	}
+	return ""
+}
+
+// loadConfigFile reads the YAML file at path and uses its values as the
+// defaults of the application's flags. This gives a precedence of flag > env >
+// file, since kingpin only falls back to defaults when neither the flag nor its
+// environment variable are set.
+//
+// Keys are flag names. Nested maps are joined with dots, so the following are
+// equivalent:
+//
+//	dtrack.poll-interval: 1h
+//
+//	dtrack:
+//	  poll-interval: 1h
+//
+// Lists are passed to repeatable flags as separate values and joined with commas
+// for all others.
+func loadConfigFile(app *kingpin.Application, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.UnmarshalStrict(b, &raw); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	values := make(map[string][]string)
+	if err := flattenConfig("", raw, values); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	// Sort the keys so that errors are reported deterministically
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		f := app.GetFlag(key)
+		if f == nil || key == configFileFlag || key == "help" || key == "version" {
+			return fmt.Errorf("parsing %s: unknown key %q", path, key)
+		}
+		if v, ok := f.Model().Value.(interface{ IsCumulative() bool }); ok && v.IsCumulative() {
+			f.Default(values[key]...)
+		} else {
+			f.Default(strings.Join(values[key], ","))
+		}
+	}
+
+	return nil
+}
+
+func flattenConfig(prefix string, raw map[string]interface{}, values map[string][]string) error {
+	for k, v := range raw {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+
+		switch v := v.(type) {
+		case map[interface{}]interface{}:
+			nested := make(map[string]interface{}, len(v))
+			for nk, nv := range v {
+				nested[fmt.Sprint(nk)] = nv
+			}
+			if err := flattenConfig(key, nested, values); err != nil {
+				return err
+			}
+		case []interface{}:
+			for _, item := range v {
+				if _, ok := item.(map[interface{}]interface{}); ok {
+					return fmt.Errorf("key %q: lists may only contain scalar values", key)
+				}
+				values[key] = append(values[key], fmt.Sprint(item))
+			}
+		case nil:
+			values[key] = []string{""}
+		default:
+			values[key] = []string{fmt.Sprint(v)}
+		}
+	}
+	return nil
+}
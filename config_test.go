@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/kingpin/v2"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	config := `
+dtrack:
+  address: http://file:8080
+  project-tags: [a, b]
+  poll-interval: 1h
+web.listen-address: [":1", ":2"]
+`
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatalf("unexpected error writing config file: %s", err)
+	}
+
+	t.Setenv("TEST_POLL_INTERVAL", "2h")
+
+	app := kingpin.New("test", "")
+	app.Flag(configFileFlag, "").String()
+	address := app.Flag("dtrack.address", "").Default("http://localhost:8080").String()
+	projectTags := app.Flag("dtrack.project-tags", "").String()
+	pollInterval := app.Flag("dtrack.poll-interval", "").Envar("TEST_POLL_INTERVAL").Default("6h").String()
+	listenAddresses := app.Flag("web.listen-address", "").Strings()
+
+	args := []string{"--config.file=" + path, "--dtrack.address=http://flag:8080"}
+	if got := configFilePath(app, args); got != path {
+		t.Fatalf("unexpected config file path: got %q, want %q", got, path)
+	}
+	if err := loadConfigFile(app, path); err != nil {
+		t.Fatalf("unexpected error loading config file: %s", err)
+	}
+	if _, err := app.Parse(args); err != nil {
+		t.Fatalf("unexpected error parsing flags: %s", err)
+	}
+
+	if want := "http://flag:8080"; *address != want {
+		t.Errorf("flag should take precedence over file: got %q, want %q", *address, want)
+	}
+	if want := "2h"; *pollInterval != want {
+		t.Errorf("env should take precedence over file: got %q, want %q", *pollInterval, want)
+	}
+	if want := "a,b"; *projectTags != want {
+		t.Errorf("unexpected project tags: got %q, want %q", *projectTags, want)
+	}
+	if len(*listenAddresses) != 2 {
+		t.Errorf("unexpected listen addresses: got %q", *listenAddresses)
+	}
+}
+
+func TestLoadConfigFile_UnknownKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte("dtrack.unknown: true\n"), 0600); err != nil {
+		t.Fatalf("unexpected error writing config file: %s", err)
+	}
+
+	app := kingpin.New("test", "")
+	app.Flag("dtrack.address", "").String()
+
+	if err := loadConfigFile(app, path); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+}
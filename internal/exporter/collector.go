@@ -0,0 +1,62 @@
+package exporter
+
+import (
+	"cmp"
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultCollectTimeout bounds a collection when the Collector has no Timeout
+const defaultCollectTimeout = time.Minute
+
+// Collector collects metrics from Dependency-Track on every scrape, so that
+// they can be included in an existing registry rather than served by the
+// standalone exporter. Every scrape makes the same API calls as a poll, so
+// scrapes should be infrequent and have a generous timeout.
+type Collector struct {
+	Exporter *Exporter
+	// Timeout bounds how long a collection waits for Dependency-Track, which
+	// defaults to one minute
+	Timeout time.Duration
+}
+
+// Describe implements prometheus.Collector. It sends no descriptors, which makes
+// the collector unchecked, since the metrics depend on what's collected.
+func (c *Collector) Describe(chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	// The exporter keeps state between collections, so collections are
+	// serialized with each other and with the polls of the same exporter
+	defer c.Exporter.lockScope(scopeAll)()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cmp.Or(c.Timeout, defaultCollectTimeout))
+	defer cancel()
+
+	var collectors collectorList
+	if err := c.Exporter.collect(ctx, &collectors, scopeAll); err != nil {
+		c.Exporter.Logger.Error("Error collecting metrics", "err", err)
+	}
+	for _, collector := range collectors {
+		collector.Collect(ch)
+	}
+}
+
+// collectorList is a prometheus.Registerer that records the collectors
+// registered with it
+type collectorList []prometheus.Collector
+
+func (l *collectorList) Register(c prometheus.Collector) error {
+	*l = append(*l, c)
+	return nil
+}
+
+func (l *collectorList) MustRegister(cs ...prometheus.Collector) {
+	*l = append(*l, cs...)
+}
+
+func (l *collectorList) Unregister(prometheus.Collector) bool {
+	return false
+}
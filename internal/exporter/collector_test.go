@@ -0,0 +1,118 @@
+package exporter
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	dtrack "github.com/DependencyTrack/client-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollector(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	mux.HandleFunc("/api/v1/metrics/portfolio/current", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dtrack.PortfolioMetrics{InheritedRiskScore: 42})
+	})
+
+	mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", "0")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.Project{})
+	})
+
+	mux.HandleFunc("/api/v1/violation", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", "0")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.PolicyViolation{})
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&Collector{
+		Exporter: &Exporter{
+			Client: client,
+			Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		},
+	})
+
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("unexpected error gathering metrics: %s", err)
+	}
+
+	var found bool
+	for _, mf := range mfs {
+		if mf.GetName() != "dependency_track_portfolio_inherited_risk_score" {
+			continue
+		}
+		found = true
+		if got := mf.GetMetric()[0].GetGauge().GetValue(); got != 42 {
+			t.Errorf("unexpected inherited risk score: got %v, want %v", got, 42)
+		}
+	}
+	if !found {
+		t.Errorf("expected dependency_track_portfolio_inherited_risk_score to be collected")
+	}
+}
+
+func TestCollector_Timeout(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	// Mock a portfolio endpoint that never responds
+	mux.HandleFunc("/api/v1/metrics/portfolio/current", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&Collector{
+		Exporter: &Exporter{
+			Client:     client,
+			Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+			Collectors: []string{"portfolio"},
+		},
+		Timeout: 50 * time.Millisecond,
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = registry.Gather()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the collection to time out")
+	}
+}
@@ -0,0 +1,72 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	dtrack "github.com/DependencyTrack/client-go"
+)
+
+// debugSampleSize is the number of projects recorded by every poll
+const debugSampleSize = 10
+
+// debugSample holds the responses of Dependency-Track recorded by a poll
+type debugSample struct {
+	Portfolio *dtrack.PortfolioMetrics `json:"portfolio"`
+	Projects  []dtrack.Project         `json:"projects"`
+}
+
+type debugSampleKey struct{}
+
+// withDebugSample returns a context that the collectors record their responses
+// into
+func withDebugSample(ctx context.Context, sample *debugSample) context.Context {
+	return context.WithValue(ctx, debugSampleKey{}, sample)
+}
+
+// debugSampleFrom returns the sample recorded into by the poll of ctx, or nil
+func debugSampleFrom(ctx context.Context) *debugSample {
+	sample, _ := ctx.Value(debugSampleKey{}).(*debugSample)
+	return sample
+}
+
+// merge returns a copy of d with the responses recorded by a poll of scope
+// replaced with those of sample. d may be nil.
+func (d *debugSample) merge(sample *debugSample, scope pollScope) *debugSample {
+	merged := &debugSample{}
+	if d != nil {
+		*merged = *d
+	}
+	if scope != scopeProjects {
+		merged.Portfolio = sample.Portfolio
+	}
+	if scope != scopePortfolio {
+		merged.Projects = sample.Projects
+	}
+	return merged
+}
+
+// DebugHandlerFunc handles requests to the debug endpoint, which returns the
+// portfolio metrics and the first projects returned by Dependency-Track during
+// the latest poll, as JSON. They're only recorded when Debug is set. The
+// response may contain sensitive project data.
+func (e *Exporter) DebugHandlerFunc() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		e.mutex.RLock()
+		sample := e.debug
+		e.mutex.RUnlock()
+
+		if sample == nil {
+			serviceUnavailable(w, r, "initializing", "No poll has been recorded yet")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(sample); err != nil {
+			e.Logger.Error("Error encoding debug response", "err", err)
+		}
+	}
+}
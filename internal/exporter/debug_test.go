@@ -0,0 +1,84 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	dtrack "github.com/DependencyTrack/client-go"
+	"github.com/google/uuid"
+)
+
+func TestExporter_DebugHandlerFunc(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	mux.HandleFunc("/api/v1/metrics/portfolio/current", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dtrack.PortfolioMetrics{InheritedRiskScore: 42})
+	})
+
+	// Mock more projects than are sampled
+	var projects []dtrack.Project
+	for range debugSampleSize + 5 {
+		projects = append(projects, dtrack.Project{UUID: uuid.New()})
+	}
+	mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(projects)))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(projects)
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+
+	e := &Exporter{
+		Client:     client,
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Collectors: []string{"portfolio", "project"},
+		PageSize:   100,
+		Debug:      true,
+	}
+	h := e.DebugHandlerFunc()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics/debug", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("unexpected status code before the first poll: got %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	if err := e.poll(context.Background()); err != nil {
+		t.Fatalf("unexpected error polling: %s", err)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics/debug", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: got %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var got debugSample
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("unexpected error decoding response: %s", err)
+	}
+	if got.Portfolio == nil || got.Portfolio.InheritedRiskScore != 42 {
+		t.Errorf("unexpected portfolio metrics: %+v", got.Portfolio)
+	}
+	if len(got.Projects) != debugSampleSize {
+		t.Errorf("unexpected number of projects: got %d, want %d", len(got.Projects), debugSampleSize)
+	}
+}
@@ -1,18 +1,33 @@
 package exporter
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
 	"log/slog"
+	"maps"
+	"math/rand/v2"
 	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	dtrack "github.com/DependencyTrack/client-go"
+	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
 )
 
 const (
@@ -20,86 +35,920 @@ const (
 	Namespace string = "dependency_track"
 )
 
+const (
+	// maxRateLimitRetries is the number of times a rate limited page is retried
+	maxRateLimitRetries = 5
+	// defaultRetryAfter is how long to wait before retrying a rate limited page
+	// when the response doesn't include a Retry-After header
+	defaultRetryAfter = 5 * time.Second
+	// initialStartupBackoff is how long to wait before retrying a failed
+	// initial poll. It doubles after every attempt, up to maxStartupBackoff.
+	initialStartupBackoff = time.Second
+	maxStartupBackoff     = time.Minute
+)
+
+// pollScope selects the collectors run by a poll, so that the portfolio can be
+// polled on a different interval than the projects
+type pollScope int
+
+const (
+	// scopeAll runs every enabled collector
+	scopeAll pollScope = iota
+	// scopePortfolio only runs the portfolio collector
+	scopePortfolio
+	// scopeProjects runs every enabled collector but the portfolio one
+	scopeProjects
+)
+
+func (s pollScope) String() string {
+	switch s {
+	case scopePortfolio:
+		return "portfolio"
+	case scopeProjects:
+		return "projects"
+	default:
+		return "all"
+	}
+}
+
+// errProjectLimitExceeded stops the iteration over projects once MaxProjects
+// have been collected
+var errProjectLimitExceeded = errors.New("project limit exceeded")
+
+// DefaultProjectInfoLabels are the labels added to dependency_track_project_info
+// when no others are configured
+var DefaultProjectInfoLabels = []string{
+	"uuid",
+	"name",
+	"version",
+	"classifier",
+	"active",
+	"tags",
+	"is_collection",
+}
+
+// identifierLabels are the labels of dependency_track_project_info holding the
+// identifiers of a project, which are added by IncludeIdentifiers
+var identifierLabels = []string{
+	"purl",
+	"cpe",
+	"swid_tag_id",
+}
+
+// projectInfoLabels maps the labels that can be added to
+// dependency_track_project_info to the project field they're read from
+var projectInfoLabels = map[string]func(dtrack.Project) string{
+	"uuid":        func(p dtrack.Project) string { return p.UUID.String() },
+	"name":        func(p dtrack.Project) string { return p.Name },
+	"version":     func(p dtrack.Project) string { return p.Version },
+	"classifier":  func(p dtrack.Project) string { return p.Classifier },
+	"active":      func(p dtrack.Project) string { return strconv.FormatBool(p.Active) },
+	"group":       func(p dtrack.Project) string { return p.Group },
+	"author":      func(p dtrack.Project) string { return p.Author },
+	"publisher":   func(p dtrack.Project) string { return p.Publisher },
+	"description": func(p dtrack.Project) string { return p.Description },
+	"purl":        func(p dtrack.Project) string { return p.PURL },
+	"cpe":         func(p dtrack.Project) string { return p.CPE },
+	"swid_tag_id": func(p dtrack.Project) string { return p.SWIDTagID },
+	"tags": func(p dtrack.Project) string {
+		var tags []string
+		for _, t := range p.Tags {
+			tags = append(tags, t.Name)
+		}
+		return strings.Join(tags, ",")
+	},
+	"is_collection": func(p dtrack.Project) string { return strconv.FormatBool(isCollection(p)) },
+	"parent_uuid": func(p dtrack.Project) string {
+		// Top-level projects have no parent, which is reported as an empty value.
+		if p.ParentRef == nil {
+			return ""
+		}
+		return p.ParentRef.UUID.String()
+	},
+}
+
+// tagLabelPattern matches the keys that can be used as tag labels. Keys are
+// restricted to valid Prometheus label names.
+var tagLabelPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ValidateTagLabels checks that the given keys can be added as labels to
+// dependency_track_project_info
+func ValidateTagLabels(keys []string) error {
+	seen := make(map[string]struct{})
+	for _, key := range keys {
+		if !tagLabelPattern.MatchString(key) {
+			return fmt.Errorf("invalid tag label %q", key)
+		}
+		if _, ok := projectInfoLabels[key]; ok {
+			return fmt.Errorf("tag label %q conflicts with a project info label", key)
+		}
+		if _, ok := seen[key]; ok {
+			return fmt.Errorf("duplicate tag label %q", key)
+		}
+		seen[key] = struct{}{}
+	}
+	return nil
+}
+
+// tagLabelValue returns the value of the first key:value tag of the project
+// with the given key, or an empty string if there is none
+func tagLabelValue(project dtrack.Project, key string) string {
+	for _, t := range project.Tags {
+		if k, v, ok := strings.Cut(t.Name, ":"); ok && k == key {
+			return v
+		}
+	}
+	return ""
+}
+
+// metricNamespacePattern matches the namespaces that can be used in metric
+// names
+var metricNamespacePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ValidateMetricNamespace checks that the given namespace can be used as the
+// prefix of metric names
+func ValidateMetricNamespace(namespace string) error {
+	if !metricNamespacePattern.MatchString(namespace) {
+		return fmt.Errorf("invalid metric namespace %q", namespace)
+	}
+	return nil
+}
+
+// Collectors are the groups of metrics that can be collected from
+// Dependency-Track
+var Collectors = []string{
+	"portfolio",
+	"project",
+	"violation",
+}
+
+// ValidateCollectors checks that the given collectors exist
+func ValidateCollectors(names []string) error {
+	for _, name := range names {
+		if !slices.Contains(Collectors, name) {
+			return fmt.Errorf("unknown collector %q", name)
+		}
+	}
+	return nil
+}
+
+// ViolationStates are the states a policy violation can be in
+var ViolationStates = []string{"INFO", "WARN", "FAIL"}
+
+// ValidateViolationStates checks that the given states are known
+func ValidateViolationStates(states []string) error {
+	for _, state := range states {
+		if !slices.Contains(ViolationStates, state) {
+			return fmt.Errorf("unknown violation state %q", state)
+		}
+	}
+	return nil
+}
+
+// Severities maps the severity label of the vulnerability metrics to the count
+// of that severity in Dependency-Track's portfolio and project metrics. A
+// severity introduced by Dependency-Track only needs a new entry here.
+var Severities = []struct {
+	Label     string
+	Portfolio func(dtrack.PortfolioMetrics) int
+	Project   func(dtrack.ProjectMetrics) int
+}{
+	{
+		Label:     "CRITICAL",
+		Portfolio: func(m dtrack.PortfolioMetrics) int { return m.Critical },
+		Project:   func(m dtrack.ProjectMetrics) int { return m.Critical },
+	},
+	{
+		Label:     "HIGH",
+		Portfolio: func(m dtrack.PortfolioMetrics) int { return m.High },
+		Project:   func(m dtrack.ProjectMetrics) int { return m.High },
+	},
+	{
+		Label:     "MEDIUM",
+		Portfolio: func(m dtrack.PortfolioMetrics) int { return m.Medium },
+		Project:   func(m dtrack.ProjectMetrics) int { return m.Medium },
+	},
+	{
+		Label:     "LOW",
+		Portfolio: func(m dtrack.PortfolioMetrics) int { return m.Low },
+		Project:   func(m dtrack.ProjectMetrics) int { return m.Low },
+	},
+	{
+		Label:     "UNASSIGNED",
+		Portfolio: func(m dtrack.PortfolioMetrics) int { return m.Unassigned },
+		Project:   func(m dtrack.ProjectMetrics) int { return m.Unassigned },
+	},
+}
+
+// portfolioSeverityCounts returns the number of vulnerabilities of every
+// severity in Severities across the portfolio
+func portfolioSeverityCounts(metrics dtrack.PortfolioMetrics) map[string]int {
+	counts := make(map[string]int, len(Severities))
+	for _, s := range Severities {
+		counts[s.Label] = s.Portfolio(metrics)
+	}
+	return counts
+}
+
+// projectSeverityCounts returns the number of vulnerabilities of every
+// severity in Severities in a project
+func projectSeverityCounts(metrics dtrack.ProjectMetrics) map[string]int {
+	counts := make(map[string]int, len(Severities))
+	for _, s := range Severities {
+		counts[s.Label] = s.Project(metrics)
+	}
+	return counts
+}
+
+// DefaultFindingAgeBuckets are the upper bounds of the buckets of
+// dependency_track_portfolio_vulnerabilities_age when no others are configured
+var DefaultFindingAgeBuckets = []time.Duration{
+	7 * 24 * time.Hour,
+	30 * 24 * time.Hour,
+	90 * 24 * time.Hour,
+}
+
+// ValidateFindingAgeBuckets checks that the given bucket bounds are positive
+// and in increasing order
+func ValidateFindingAgeBuckets(buckets []time.Duration) error {
+	for i, b := range buckets {
+		if b <= 0 {
+			return fmt.Errorf("bucket %s must be positive", b)
+		}
+		if i > 0 && b <= buckets[i-1] {
+			return fmt.Errorf("buckets must be in increasing order, got %s after %s", b, buckets[i-1])
+		}
+	}
+	return nil
+}
+
+// ValidateProjectInfoLabels checks that the given labels can be added to
+// dependency_track_project_info
+func ValidateProjectInfoLabels(labels []string) error {
+	seen := make(map[string]struct{})
+	for _, label := range labels {
+		if _, ok := projectInfoLabels[label]; !ok {
+			return fmt.Errorf("unknown project info label %q", label)
+		}
+		if _, ok := seen[label]; ok {
+			return fmt.Errorf("duplicate project info label %q", label)
+		}
+		seen[label] = struct{}{}
+	}
+	if _, ok := seen["uuid"]; !ok {
+		return fmt.Errorf("project info labels must include %q", "uuid")
+	}
+	return nil
+}
+
 // Exporter exports metrics from a Dependency-Track server
 type Exporter struct {
-	Client                     *dtrack.Client
-	Logger                     *slog.Logger
-	ProjectTags                []string
-	InitializeViolationMetrics bool
+	Client *dtrack.Client
+	// NewClient creates Client when it's nil. Creating a client fetches the
+	// version of Dependency-Track, so it's deferred until the first request
+	// and retried by every poll until it succeeds, which lets the exporter
+	// start before Dependency-Track.
+	NewClient          func() (*dtrack.Client, error)
+	Logger             *slog.Logger
+	ProjectTags        []string
+	ProjectClassifiers []string
+	// OnlyProjectsWithViolations restricts the matched projects to those whose
+	// metrics report at least one policy violation or vulnerability
+	OnlyProjectsWithViolations     bool
+	ProjectUUIDs                   []uuid.UUID
+	ProjectInfoLabels              []string
+	TagLabels                      []string
+	AggregateTags                  []string
+	Collectors                     []string
+	InitializeViolationMetrics     bool
+	CollectFindings                bool
+	CollectFindingsBySource        bool
+	CollectVulnerabilitiesDetailed bool
+	CollectAffectedProjects        bool
+	// CollectComponents counts the components of every project by type, which
+	// takes an additional paginated API call per project
+	CollectComponents bool
+	// CollectLicenses counts the components of the matched projects by
+	// license, from the same API calls as CollectComponents
+	CollectLicenses bool
+	// RefreshMetrics asks Dependency-Track to recompute the metrics of every
+	// matched project during a poll. They're recomputed asynchronously, so
+	// the fresh values are read by the next poll.
+	RefreshMetrics bool
+	// AffectedProjectsLimit caps the vulnerabilities reported by
+	// dependency_track_vulnerability_affected_projects to those affecting the
+	// most projects. Use 0 to report all of them.
+	AffectedProjectsLimit     int
+	IncludeSuppressedFindings bool
+	// RecentSuppressionWindow counts the suppressed findings of every project
+	// that were suppressed within the window, which takes an additional API
+	// call per suppressed finding. It requires CollectFindings and
+	// IncludeSuppressedFindings. Use 0 to disable.
+	RecentSuppressionWindow time.Duration
+	CollectPolicies         bool
+	CollectProjectTags      bool
+	IncludeParentLabels     bool
+	// IncludeIdentifiers adds the purl, cpe and swid_tag_id labels to
+	// dependency_track_project_info
+	IncludeIdentifiers bool
+	// ViolationStates restricts the policy violations that are collected to
+	// those in the given states. All are collected when it's empty.
+	ViolationStates []string
+	// FindingAgeBuckets are the upper bounds of the buckets findings are
+	// counted in by age, which default to DefaultFindingAgeBuckets
+	FindingAgeBuckets []time.Duration
+	// UUIDOnlyLabels drops the name and version labels from the main project
+	// metrics, which keeps their series stable when projects are renamed or
+	// versioned. They can be joined from dependency_track_project_info.
+	UUIDOnlyLabels bool
+	MaxProjects    int
+	MetricsMaxAge  time.Duration
+	// StaleBOMThreshold is the age of the last BOM import of a project above
+	// which it's reported as stale. Use 0 to disable.
+	StaleBOMThreshold time.Duration
+	// StartupTimeout bounds how long a failed initial poll is retried for,
+	// before falling back to the poll interval. Use 0 to disable retries.
+	StartupTimeout      time.Duration
+	PageSize            int
+	MaxRequestsInFlight int
+	MaxDataAge          time.Duration
+	// RefreshShards splits the projects into this many shards, of which only
+	// one has its findings refreshed per poll. The findings of the other
+	// shards are served from the previous polls. Use 0 or 1 to refresh all
+	// projects on every poll.
+	RefreshShards int
+	// MetricNamespace overrides the namespace of the exported metrics, which
+	// defaults to Namespace
+	MetricNamespace string
+	// PushGateway is the URL of a Pushgateway the metrics are pushed to after
+	// every successful poll, under PushJob and PushGrouping
+	PushGateway  string
+	PushJob      string
+	PushGrouping map[string]string
+	// OutputFile is the path of a file the metrics are written to after every
+	// successful poll, for the textfile collector of the node exporter
+	OutputFile string
+	// PollJitter is the maximum random delay before the initial poll, which
+	// spreads the polls of replicas that were started at the same time
+	PollJitter time.Duration
+	// PortfolioPollInterval and ProjectPollInterval override the interval
+	// passed to Run for the portfolio collector and for the other collectors
+	// respectively. When they differ, each is polled on its own ticker.
+	PortfolioPollInterval time.Duration
+	ProjectPollInterval   time.Duration
+	// RefreshMinInterval is the minimum time between two refreshes requested
+	// with RefreshHandlerFunc
+	RefreshMinInterval time.Duration
+	// Debug records the portfolio metrics and a sample of the projects
+	// returned by Dependency-Track during every poll, for DebugHandlerFunc
+	Debug bool
+	// CollectorStatus records the outcome of every run of the collectors. It
+	// should be registered with Gatherer.
+	CollectorStatus *CollectorStatus
+	// Gatherer gathers the metrics that outlive a poll, such as those about
+	// the exporter itself. It's served alongside the metrics of the latest
+	// poll, and defaults to prometheus.DefaultGatherer.
+	Gatherer prometheus.Gatherer
+
+	mutex              sync.RWMutex
+	clientMutex        sync.Mutex
+	portfolioPollMutex sync.Mutex
+	projectsPollMutex  sync.Mutex
+	registry           *prometheus.Registry
+	lastSuccessfulPoll time.Time
+	pollInterval       time.Duration
+	// Whether Run polls the portfolio on its own interval
+	splitPolls bool
+	// The registry and last success of the portfolio collector, when it's
+	// polled on its own interval
+	portfolioRegistry           *prometheus.Registry
+	lastSuccessfulPortfolioPoll time.Time
+	// The responses recorded by the latest polls, when Debug is set
+	debug *debugSample
+
+	portfolioMetricsUnavailable bool
+
+	// The inherited risk score of the portfolio as of the previous poll, or
+	// nil before the first
+	previousPortfolioRiskScore *float64
+
+	// Policy violations are compared with those seen by the previous poll to
+	// count new ones, since Dependency-Track doesn't report when they occurred
+	newPolicyViolations  *prometheus.CounterVec
+	seenPolicyViolations map[uuid.UUID]struct{}
+	// The UUIDs of the projects with a series of newPolicyViolations, which
+	// are deleted once the project is no longer matched
+	newPolicyViolationProjects map[string]struct{}
 
-	mutex    sync.RWMutex
-	registry *prometheus.Registry
+	projectCollectionErrors prometheus.Counter
+
+	// The shard refreshed by the next poll, and the findings of every project
+	// as of its shard's last refresh
+	refreshShard  int
+	findingsCache map[uuid.UUID][]*cachedFinding
+
+	// The project collected by a probe, in place of those matching the filters
+	project *dtrack.Project
 }
 
 // HandlerFunc handles requests to /metrics
 func (e *Exporter) HandlerFunc() http.HandlerFunc {
+	// The handler is created once so that the in-flight request limit is
+	// shared across all requests. It gathers from whichever registry was
+	// stored by the most recent poll.
+	gatherer := prometheus.Gatherers{e.gatherer(), prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		e.mutex.RLock()
+		registries := e.registries()
+		e.mutex.RUnlock()
+		return registries.Gather()
+	})}
+	h := promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{
+		MaxRequestsInFlight: e.MaxRequestsInFlight,
+		EnableOpenMetrics:   true,
+	})
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		e.mutex.RLock()
-		registry := e.registry
+		registries := e.registries()
+		lastSuccessfulPoll := e.lastSuccessfulPoll
+		// The data is as old as the least recently updated collector
+		if e.portfolioRegistry != nil && e.lastSuccessfulPortfolioPoll.Before(lastSuccessfulPoll) {
+			lastSuccessfulPoll = e.lastSuccessfulPortfolioPoll
+		}
 		e.mutex.RUnlock()
 
-		if registry == nil {
-			http.Error(w, "Exporter not yet initialized", http.StatusServiceUnavailable)
+		if len(registries) == 0 {
+			serviceUnavailable(w, r, "initializing", "Exporter not yet initialized")
+			return
+		}
+
+		// Refuse to serve data that's older than allowed, so that a prolonged
+		// Dependency-Track outage is noticed rather than hidden behind the
+		// metrics of the last successful poll
+		if e.MaxDataAge > 0 && time.Since(lastSuccessfulPoll) > e.MaxDataAge {
+			serviceUnavailable(w, r, "stale", "No successful poll of Dependency-Track within the maximum data age")
 			return
 		}
 
 		// Serve
-		h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
 		h.ServeHTTP(w, r)
 	}
 }
 
+// serviceUnavailable responds with a 503, using a JSON body for clients that
+// accept it
+func serviceUnavailable(w http.ResponseWriter, r *http.Request, status, message string) {
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": status})
+		return
+	}
+	http.Error(w, message, http.StatusServiceUnavailable)
+}
+
 // Run starts the background polling of Dependency-Track metrics
 func (e *Exporter) Run(ctx context.Context, interval time.Duration) {
+	portfolioInterval := cmp.Or(e.PortfolioPollInterval, interval)
+	projectInterval := cmp.Or(e.ProjectPollInterval, interval)
+	split := portfolioInterval != projectInterval && e.collectorEnabled("portfolio") && e.projectScopeEnabled()
+	if !split && !e.projectScopeEnabled() {
+		interval = portfolioInterval
+	} else {
+		interval = projectInterval
+	}
+	e.pollInterval = interval
+	e.mutex.Lock()
+	e.splitPolls = split
+	e.mutex.Unlock()
+
+	// The ticker is only started after the jitter, so that later polls are
+	// offset as well
+	if e.PollJitter > 0 {
+		jitter := rand.N(e.PollJitter)
+		e.Logger.Info("Delaying initial poll", "jitter", jitter)
+		timer := time.NewTimer(jitter)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			e.Logger.Info("Stopping background poller")
+			return
+		case <-timer.C:
+		}
+	}
+
+	if !split {
+		e.runScope(ctx, scopeAll, interval)
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		e.runScope(ctx, scopePortfolio, portfolioInterval)
+	}()
+	go func() {
+		defer wg.Done()
+		e.runScope(ctx, scopeProjects, projectInterval)
+	}()
+	wg.Wait()
+}
+
+// scopes returns the scopes polled by Run. Each scope only replaces its own
+// metrics, so polling every collector at once while the portfolio has its own
+// interval would duplicate the portfolio metrics.
+func (e *Exporter) scopes() []pollScope {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	if e.splitPolls {
+		return []pollScope{scopePortfolio, scopeProjects}
+	}
+	return []pollScope{scopeAll}
+}
+
+// runScope polls the collectors of scope every interval, until ctx is done
+func (e *Exporter) runScope(ctx context.Context, scope pollScope, interval time.Duration) {
+	logger := e.Logger
+	if scope != scopeAll {
+		logger = logger.With("scope", scope.String())
+	}
+	logger.Info("Starting background poller", "interval", interval)
+
+	update := func() error {
+		return e.update(ctx, scope)
+	}
+
+	// Initial poll, retried so that the exporter doesn't wait a whole interval
+	// when Dependency-Track starts after it
+	e.startup(ctx, update)
+
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	e.Logger.Info("Starting background poller", "interval", interval)
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Stopping background poller")
+			return
+		case <-ticker.C:
+			_ = update()
+		}
+	}
+}
 
-	// Initial poll
-	e.poll(ctx)
+// update polls the collectors of scope, and publishes the metrics to the
+// configured Pushgateway and output file when the poll succeeds
+func (e *Exporter) update(ctx context.Context, scope pollScope) error {
+	err := e.pollScope(ctx, scope)
+	if err == nil && e.PushGateway != "" {
+		e.push(ctx)
+	}
+	if err == nil && e.OutputFile != "" {
+		if err := e.writeOutputFile(); err != nil {
+			e.Logger.Error("Error writing metrics to the output file", "path", e.OutputFile, "err", err)
+		}
+	}
+	return err
+}
 
+// startup calls update until it succeeds, backing off exponentially between
+// attempts, or until StartupTimeout has elapsed
+func (e *Exporter) startup(ctx context.Context, update func() error) {
+	deadline := time.Now().Add(e.StartupTimeout)
+	backoff := initialStartupBackoff
 	for {
+		err := update()
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			if e.StartupTimeout > 0 {
+				e.Logger.Warn("Initial poll failed, waiting for the next poll", "startup_timeout", e.StartupTimeout)
+			}
+			return
+		}
+
+		wait := min(backoff, remaining)
+		e.Logger.Info("Retrying initial poll", "backoff", wait)
+		timer := time.NewTimer(wait)
 		select {
 		case <-ctx.Done():
-			e.Logger.Info("Stopping background poller")
+			timer.Stop()
 			return
-		case <-ticker.C:
-			e.poll(ctx)
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, maxStartupBackoff)
+	}
+}
+
+// push pushes the metrics of the latest poll to the Pushgateway. Errors are
+// logged, since the metrics can still be scraped.
+func (e *Exporter) push(ctx context.Context) {
+	e.mutex.RLock()
+	gatherer := append(prometheus.Gatherers{e.gatherer()}, e.registries()...)
+	e.mutex.RUnlock()
+
+	pusher := push.New(e.PushGateway, e.PushJob).Gatherer(gatherer)
+	for name, value := range e.PushGrouping {
+		pusher = pusher.Grouping(name, value)
+	}
+	if err := pusher.PushContext(ctx); err != nil {
+		e.Logger.Error("Error pushing metrics to the Pushgateway", "err", err)
+		return
+	}
+	e.Logger.Debug("Pushed metrics to the Pushgateway", "url", e.PushGateway, "job", e.PushJob)
+}
+
+// writeOutputFile writes the metrics of the latest polls to OutputFile in the
+// Prometheus text format. The file is replaced atomically, so that readers
+// never see a partially written file. The metrics of Gatherer aren't written,
+// since the Go and process metrics would clash with those of the node
+// exporter.
+func (e *Exporter) writeOutputFile() error {
+	e.mutex.RLock()
+	registries := e.registries()
+	e.mutex.RUnlock()
+
+	mfs, err := registries.Gather()
+	if err != nil {
+		return err
+	}
+
+	// The temporary file is created next to the output file, since renames
+	// are only atomic within a filesystem
+	f, err := os.CreateTemp(filepath.Dir(e.OutputFile), "."+filepath.Base(e.OutputFile)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	for _, mf := range mfs {
+		if _, err := expfmt.MetricFamilyToText(f, mf); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// CreateTemp creates files that only the owner can read
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), e.OutputFile)
+}
+
+// DryRun performs a single poll and writes the collected metrics to w in the
+// Prometheus text format
+func (e *Exporter) DryRun(ctx context.Context, w io.Writer) error {
+	if err := e.poll(ctx); err != nil {
+		return err
+	}
+
+	mfs, err := e.registry.Gather()
+	if err != nil {
+		return err
+	}
+	for _, mf := range mfs {
+		if _, err := expfmt.MetricFamilyToText(w, mf); err != nil {
+			return err
 		}
 	}
+
+	return nil
+}
+
+// poll runs every enabled collector
+func (e *Exporter) poll(ctx context.Context) error {
+	return e.pollScope(ctx, scopeAll)
 }
 
-func (e *Exporter) poll(ctx context.Context) {
-	e.Logger.Debug("Polling Dependency-Track metrics")
+// pollScope runs the enabled collectors of scope, and replaces the metrics of
+// its previous poll with theirs
+func (e *Exporter) pollScope(ctx context.Context, scope pollScope) error {
+	defer e.lockScope(scope)()
+
+	e.Logger.Debug("Polling Dependency-Track metrics", "scope", scope.String())
 	registry := prometheus.NewRegistry()
-	registry.MustRegister(collectors.NewBuildInfoCollector())
+	// The metrics about the exporter are served by the registry of the
+	// projects, so that they aren't duplicated
+	if scope != scopePortfolio {
+		e.registerPollMetrics(registry)
+	}
 
-	if err := e.collectPortfolioMetrics(ctx, registry); err != nil {
-		e.Logger.Error("Error collecting portfolio metrics", "err", err)
+	var sample *debugSample
+	if e.Debug {
+		sample = &debugSample{}
+		ctx = withDebugSample(ctx, sample)
 	}
 
-	if err := e.collectProjectMetrics(ctx, registry); err != nil {
-		e.Logger.Error("Error collecting project metrics", "err", err)
+	err := e.collect(ctx, registry, scope)
+	// A cancelled poll is incomplete, so the metrics of the previous one are
+	// kept
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
 
 	e.mutex.Lock()
-	e.registry = registry
+	if scope == scopePortfolio {
+		e.portfolioRegistry = registry
+		if err == nil {
+			e.lastSuccessfulPortfolioPoll = time.Now()
+		}
+	} else {
+		e.registry = registry
+		if err == nil {
+			e.lastSuccessfulPoll = time.Now()
+		}
+	}
+	if sample != nil {
+		e.debug = e.debug.merge(sample, scope)
+	}
 	e.mutex.Unlock()
-	e.Logger.Debug("Successfully updated metrics cache")
+	e.Logger.Debug("Successfully updated metrics cache", "scope", scope.String())
+
+	return err
+}
+
+// lockScope locks the collectors of scope and returns the function unlocking
+// them. The collectors keep state between polls, so polls of the same
+// collectors never overlap. The locks are always taken in the same order.
+func (e *Exporter) lockScope(scope pollScope) func() {
+	if scope != scopeProjects {
+		e.portfolioPollMutex.Lock()
+	}
+	if scope != scopePortfolio {
+		e.projectsPollMutex.Lock()
+	}
+	return func() {
+		if scope != scopePortfolio {
+			e.projectsPollMutex.Unlock()
+		}
+		if scope != scopeProjects {
+			e.portfolioPollMutex.Unlock()
+		}
+	}
+}
+
+// connect creates Client with NewClient, unless it's already set. It must be
+// called before Client is used.
+func (e *Exporter) connect() error {
+	e.clientMutex.Lock()
+	defer e.clientMutex.Unlock()
+	if e.Client != nil || e.NewClient == nil {
+		return nil
+	}
+	client, err := e.NewClient()
+	if err != nil {
+		return err
+	}
+	e.Client = client
+	return nil
+}
+
+// registerPollMetrics registers the metrics describing the configuration of
+// the poller with registry
+func (e *Exporter) registerPollMetrics(registry prometheus.Registerer) {
+	if e.pollInterval > 0 {
+		registry.MustRegister(prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(e.namespace(), "exporter", "poll_interval_seconds"),
+				Help: "The configured interval between polls of Dependency-Track, in seconds.",
+			},
+			func() float64 { return e.pollInterval.Seconds() },
+		))
+	}
+	registry.MustRegister(e.configInfo(), &lastPollCollector{
+		exporter: e,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(e.namespace(), "exporter", "last_successful_poll_timestamp_seconds"),
+			"The time of the last successful poll of Dependency-Track, in seconds since the epoch, by scope.",
+			[]string{"scope"},
+			nil,
+		),
+	})
+}
+
+// lastPollCollector reports the time of the last successful poll of every
+// scope. When the portfolio is polled on its own interval, the portfolio and
+// project scopes are reported separately.
+type lastPollCollector struct {
+	exporter *Exporter
+	desc     *prometheus.Desc
+}
+
+func (c *lastPollCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *lastPollCollector) Collect(ch chan<- prometheus.Metric) {
+	e := c.exporter
+	e.mutex.RLock()
+	polls := map[pollScope]time.Time{scopeAll: e.lastSuccessfulPoll}
+	if e.portfolioRegistry != nil {
+		polls = map[pollScope]time.Time{
+			scopePortfolio: e.lastSuccessfulPortfolioPoll,
+			scopeProjects:  e.lastSuccessfulPoll,
+		}
+	}
+	e.mutex.RUnlock()
+
+	for scope, t := range polls {
+		// A scope that never succeeded is reported as the epoch, so that
+		// alerts on the age of the last poll fire
+		var timestamp float64
+		if !t.IsZero() {
+			timestamp = float64(t.UnixNano()) / 1e9
+		}
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, timestamp, scope.String())
+	}
+}
+
+// registries returns the registries of the latest polls. The caller must hold
+// the mutex.
+func (e *Exporter) registries() prometheus.Gatherers {
+	var registries prometheus.Gatherers
+	if e.registry != nil {
+		registries = append(registries, e.registry)
+	}
+	if e.portfolioRegistry != nil {
+		registries = append(registries, e.portfolioRegistry)
+	}
+	return registries
+}
+
+// collect registers the metrics collected from Dependency-Track by the
+// collectors of scope with registry
+func (e *Exporter) collect(ctx context.Context, registry prometheus.Registerer, scope pollScope) error {
+	if err := e.connect(); err != nil {
+		e.Logger.Error("Error creating client", "err", err)
+		return err
+	}
+
+	var errs []error
+	if scope != scopeProjects && e.collectorEnabled("portfolio") {
+		start := time.Now()
+		err := e.collectPortfolioMetrics(ctx, registry)
+		var apiErr *dtrack.APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			// A server without portfolio metrics is skipped rather than
+			// failed. Only log the first time the endpoint is found to be
+			// missing, so that such servers don't spam the logs on every poll.
+			e.recordCollector("portfolio", start, nil)
+			if !e.portfolioMetricsUnavailable {
+				e.Logger.Warn("Portfolio metrics are not available on this server, skipping", "err", err)
+				e.portfolioMetricsUnavailable = true
+			}
+		} else {
+			e.recordCollector("portfolio", start, err)
+			if err != nil {
+				e.Logger.Error("Error collecting portfolio metrics", "err", err)
+				errs = append(errs, err)
+			} else if e.portfolioMetricsUnavailable {
+				e.Logger.Info("Portfolio metrics are available again")
+				e.portfolioMetricsUnavailable = false
+			}
+		}
+	}
+
+	if scope == scopePortfolio {
+		return errors.Join(errs...)
+	}
+
+	// The violation pass is filtered on the projects matched by the project
+	// pass, so the projects are listed if either is enabled
+	if e.collectorEnabled("project") || e.collectorEnabled("violation") {
+		if err := e.collectProjectMetrics(ctx, registry); err != nil {
+			e.Logger.Error("Error collecting project metrics", "err", err)
+			errs = append(errs, err)
+		}
+	}
+
+	if e.CollectPolicies {
+		if err := e.collectPolicyMetrics(ctx, registry); err != nil {
+			e.Logger.Error("Error collecting policy metrics", "err", err)
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
 }
 
-func (e *Exporter) collectPortfolioMetrics(ctx context.Context, registry *prometheus.Registry) error {
+func (e *Exporter) collectPortfolioMetrics(ctx context.Context, registry prometheus.Registerer) error {
+	namespace := e.namespace()
 	var (
 		inheritedRiskScore = prometheus.NewGauge(
 			prometheus.GaugeOpts{
-				Name: prometheus.BuildFQName(Namespace, "portfolio", "inherited_risk_score"),
+				Name: prometheus.BuildFQName(namespace, "portfolio", "inherited_risk_score"),
 				Help: "The inherited risk score of the whole portfolio.",
 			},
 		)
 		vulnerabilities = prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Name: prometheus.BuildFQName(Namespace, "portfolio", "vulnerabilities"),
+				Name: prometheus.BuildFQName(namespace, "portfolio", "vulnerabilities"),
 				Help: "Number of vulnerabilities across the whole portfolio, by severity.",
 			},
 			[]string{
@@ -108,18 +957,56 @@ func (e *Exporter) collectPortfolioMetrics(ctx context.Context, registry *promet
 		)
 		findings = prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Name: prometheus.BuildFQName(Namespace, "portfolio", "findings"),
+				Name: prometheus.BuildFQName(namespace, "portfolio", "findings"),
 				Help: "Number of findings across the whole portfolio, audited and unaudited.",
 			},
 			[]string{
 				"audited",
 			},
 		)
+		components = prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "portfolio", "components"),
+				Help: "Number of components across the whole portfolio.",
+			},
+		)
+		vulnerableComponents = prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "portfolio", "vulnerable_components"),
+				Help: "Number of components with known vulnerabilities across the whole portfolio.",
+			},
+		)
+		projects = prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "portfolio", "projects"),
+				Help: "Number of projects in the portfolio.",
+			},
+		)
+		vulnerableProjects = prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "portfolio", "vulnerable_projects"),
+				Help: "Number of projects with known vulnerabilities in the portfolio.",
+			},
+		)
+		policyViolations = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "portfolio", "policy_violations_by_type"),
+				Help: "Number of policy violations across the whole portfolio, by type.",
+			},
+			[]string{
+				"type",
+			},
+		)
 	)
 	registry.MustRegister(
 		inheritedRiskScore,
 		vulnerabilities,
 		findings,
+		components,
+		vulnerableComponents,
+		projects,
+		vulnerableProjects,
+		policyViolations,
 	)
 
 	portfolioMetrics, err := e.Client.Metrics.LatestPortfolioMetrics(ctx)
@@ -127,16 +1014,29 @@ func (e *Exporter) collectPortfolioMetrics(ctx context.Context, registry *promet
 		return err
 	}
 
-	inheritedRiskScore.Set(portfolioMetrics.InheritedRiskScore)
+	if sample := debugSampleFrom(ctx); sample != nil {
+		sample.Portfolio = &portfolioMetrics
+	}
 
-	severities := map[string]int{
-		"CRITICAL":   portfolioMetrics.Critical,
-		"HIGH":       portfolioMetrics.High,
-		"MEDIUM":     portfolioMetrics.Medium,
-		"LOW":        portfolioMetrics.Low,
-		"UNASSIGNED": portfolioMetrics.Unassigned,
+	inheritedRiskScore.Set(portfolioMetrics.InheritedRiskScore)
+	// The first poll has nothing to compare with, so no delta is exported
+	if previous := e.previousPortfolioRiskScore; previous != nil {
+		inheritedRiskScoreDelta := prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "portfolio", "inherited_risk_score_delta"),
+				Help: "The change in the inherited risk score of the whole portfolio since the previous poll.",
+			},
+		)
+		registry.MustRegister(inheritedRiskScoreDelta)
+		inheritedRiskScoreDelta.Set(portfolioMetrics.InheritedRiskScore - *previous)
 	}
-	for severity, v := range severities {
+	e.previousPortfolioRiskScore = &portfolioMetrics.InheritedRiskScore
+	components.Set(float64(portfolioMetrics.Components))
+	vulnerableComponents.Set(float64(portfolioMetrics.VulnerableComponents))
+	projects.Set(float64(portfolioMetrics.Projects))
+	vulnerableProjects.Set(float64(portfolioMetrics.VulnerableProjects))
+
+	for severity, v := range portfolioSeverityCounts(portfolioMetrics) {
 		vulnerabilities.With(prometheus.Labels{
 			"severity": severity,
 		}).Set(float64(v))
@@ -152,136 +1052,786 @@ func (e *Exporter) collectPortfolioMetrics(ctx context.Context, registry *promet
 		}).Set(float64(v))
 	}
 
+	// The types match the ones exported by the violation collector, so the
+	// total is left to sum() rather than exported as a type of its own
+	violationTypes := map[string]int{
+		"LICENSE":     portfolioMetrics.PolicyViolationsLicenseTotal,
+		"OPERATIONAL": portfolioMetrics.PolicyViolationsOperationalTotal,
+		"SECURITY":    portfolioMetrics.PolicyViolationsSecurityTotal,
+	}
+	for violationType, v := range violationTypes {
+		policyViolations.With(prometheus.Labels{
+			"type": violationType,
+		}).Set(float64(v))
+	}
+
 	return nil
 }
 
-func (e *Exporter) collectProjectMetrics(ctx context.Context, registry *prometheus.Registry) error {
+func (e *Exporter) collectProjectMetrics(ctx context.Context, registry prometheus.Registerer) error {
+	start := time.Now()
+	namespace := e.namespace()
+	infoLabels := e.ProjectInfoLabels
+	if len(infoLabels) == 0 {
+		infoLabels = DefaultProjectInfoLabels
+	}
+	if e.IncludeParentLabels && !slices.Contains(infoLabels, "parent_uuid") {
+		infoLabels = append(slices.Clone(infoLabels), "parent_uuid")
+	}
+	if e.IncludeIdentifiers {
+		for _, label := range identifierLabels {
+			if !slices.Contains(infoLabels, label) {
+				infoLabels = append(slices.Clone(infoLabels), label)
+			}
+		}
+	}
+	numInfoLabels := len(infoLabels)
+	infoLabels = append(slices.Clone(infoLabels), e.TagLabels...)
+
+	identityLabels := []string{"uuid", "name", "version"}
+	if e.UUIDOnlyLabels {
+		identityLabels = []string{"uuid"}
+	}
+	identity := func(id, name, version string, values ...string) []string {
+		if e.UUIDOnlyLabels {
+			return append([]string{id}, values...)
+		}
+		return append([]string{id, name, version}, values...)
+	}
+
 	var (
 		info = prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Name: prometheus.BuildFQName(Namespace, "project", "info"),
+				Name: prometheus.BuildFQName(namespace, "project", "info"),
 				Help: "Project information.",
 			},
-			[]string{
-				"uuid",
-				"name",
-				"version",
-				"classifier",
-				"active",
-				"tags",
-			},
+			infoLabels,
 		)
 		vulnerabilities = prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Name: prometheus.BuildFQName(Namespace, "project", "vulnerabilities"),
+				Name: prometheus.BuildFQName(namespace, "project", "vulnerabilities"),
 				Help: "Number of vulnerabilities for a project by severity.",
 			},
+			append(slices.Clone(identityLabels),
+				"severity",
+			),
+		)
+		findings = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "project", "findings"),
+				Help: "Number of findings for a project, audited and unaudited.",
+			},
 			[]string{
 				"uuid",
 				"name",
 				"version",
-				"severity",
+				"audited",
 			},
 		)
 		policyViolations = prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Name: prometheus.BuildFQName(Namespace, "project", "policy_violations"),
+				Name: prometheus.BuildFQName(namespace, "project", "policy_violations"),
 				Help: "Policy violations for a project.",
 			},
-			[]string{
-				"uuid",
-				"name",
-				"version",
+			append(slices.Clone(identityLabels),
 				"type",
 				"state",
 				"analysis",
 				"suppressed",
+			),
+		)
+		portfolioPolicyViolations = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "portfolio", "policy_violations"),
+				Help: "Number of policy violations across the matched projects, by type, state and suppression.",
+			},
+			[]string{
+				"type",
+				"state",
+				"suppressed",
 			},
 		)
-		lastBOMImport = prometheus.NewGaugeVec(
+		suppressedPolicyViolations = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "project", "suppressed_policy_violations"),
+				Help: "Number of suppressed policy violations for a project.",
+			},
+			append(slices.Clone(identityLabels),
+				"type",
+			),
+		)
+		policyViolationsAudited = prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Name: prometheus.BuildFQName(Namespace, "project", "last_bom_import"),
-				Help: "Last BOM import date, represented as a Unix timestamp.",
+				Name: prometheus.BuildFQName(namespace, "project", "policy_violations_audited"),
+				Help: "Number of policy violations for a project, audited and unaudited.",
 			},
 			[]string{
 				"uuid",
 				"name",
 				"version",
+				"audited",
+			},
+		)
+		lastBOMImport = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "project", "last_bom_import"),
+				Help: "Last BOM import date, represented as a Unix timestamp in milliseconds.",
+			},
+			identityLabels,
+		)
+		active = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "project", "active"),
+				Help: "Whether a project is active.",
+			},
+			[]string{
+				"uuid",
+			},
+		)
+		hasBOM = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "project", "has_bom"),
+				Help: "Whether a BOM was ever imported for a project.",
 			},
+			identityLabels,
 		)
 		inheritedRiskScore = prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Name: prometheus.BuildFQName(Namespace, "project", "inherited_risk_score"),
+				Name: prometheus.BuildFQName(namespace, "project", "inherited_risk_score"),
 				Help: "Inherited risk score for a project.",
 			},
+			identityLabels,
+		)
+		metricsLastMeasurement = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "project", "metrics_last_measurement_seconds"),
+				Help: "When Dependency-Track last computed the metrics for a project, represented as a Unix timestamp.",
+			},
+			[]string{
+				"uuid",
+				"name",
+				"version",
+			},
+		)
+		findingsTotal = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "project", "findings_total"),
+				Help: "Total number of findings for a project. A vulnerability affecting several components of a project is a finding for each of them.",
+			},
+			[]string{
+				"uuid",
+				"name",
+				"version",
+			},
+		)
+		findingsSuppressed = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "project", "findings_suppressed"),
+				Help: "Number of suppressed findings for a project.",
+			},
+			[]string{
+				"uuid",
+				"name",
+				"version",
+			},
+		)
+		tag = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "project", "tag"),
+				Help: "Tags of a project, set to 1 for each tag.",
+			},
+			[]string{
+				"uuid",
+				"name",
+				"version",
+				"tag",
+			},
+		)
+		metricsMissing = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "project", "metrics_missing"),
+				Help: "Whether Dependency-Track has never computed the metrics of a project.",
+			},
+			[]string{
+				"uuid",
+				"name",
+				"version",
+			},
+		)
+		metricsStale = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "project", "metrics_stale"),
+				Help: "Whether Dependency-Track last computed the metrics for a project longer ago than the configured maximum age.",
+			},
+			[]string{
+				"uuid",
+				"name",
+				"version",
+			},
+		)
+		bomStale = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "project", "bom_stale"),
+				Help: "Whether the last BOM import of a project is older than the configured threshold, or there was none.",
+			},
+			[]string{
+				"uuid",
+				"name",
+				"version",
+			},
+		)
+		children = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "project", "children"),
+				Help: "Number of direct children of a project.",
+			},
+			[]string{
+				"uuid",
+				"name",
+				"version",
+			},
+		)
+		versions = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "project", "versions"),
+				Help: "Number of versions of a project, by project name.",
+			},
+			[]string{
+				"name",
+			},
+		)
+		finding = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "project", "finding"),
+				Help: "Findings for a project, set to 1 for each finding.",
+			},
+			[]string{
+				"uuid",
+				"name",
+				"version",
+				"vuln_id",
+				"source",
+				"severity",
+				"analysis_state",
+				"suppressed",
+			},
+		)
+		findingAnalysis = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "project", "finding_analysis"),
+				Help: "Number of findings for a project, by analysis state.",
+			},
+			[]string{
+				"uuid",
+				"name",
+				"version",
+				"analysis_state",
+			},
+		)
+		maxCVSS = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "project", "max_cvss"),
+				Help: "The highest CVSS base score among the findings of a project.",
+			},
+			[]string{
+				"uuid",
+				"name",
+				"version",
+			},
+		)
+		oldestFindingAge = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "project", "oldest_finding_age_seconds"),
+				Help: "Time since the oldest unaudited finding of a project was attributed, in seconds.",
+			},
+			[]string{
+				"uuid",
+				"name",
+				"version",
+			},
+		)
+		findingsSuppressedRecent = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "project", "findings_suppressed_recent"),
+				Help: "Number of findings of a project suppressed within the configured window.",
+			},
+			[]string{
+				"uuid",
+				"name",
+				"version",
+			},
+		)
+		vulnerabilitiesDetailed = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "project", "vulnerabilities_detailed"),
+				Help: "Number of vulnerabilities for a project by severity and analysis state.",
+			},
 			[]string{
 				"uuid",
 				"name",
 				"version",
+				"severity",
+				"analysis_state",
+			},
+		)
+		componentsByType = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "project", "components_by_type"),
+				Help: "Number of components of a project by type.",
+			},
+			append(slices.Clone(identityLabels),
+				"type",
+			),
+		)
+		licenses = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "portfolio", "licenses"),
+				Help: "Number of components of the matched projects using a license.",
+			},
+			[]string{
+				"license_id",
+			},
+		)
+		distinctLicenses = prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "portfolio", "distinct_licenses"),
+				Help: "Number of distinct licenses used by the components of the matched projects.",
+			},
+		)
+		findingsBySource = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "portfolio", "findings_by_source"),
+				Help: "Number of findings across the matched projects, by vulnerability source.",
+			},
+			[]string{
+				"source",
+			},
+		)
+		vulnerabilitiesAge = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "portfolio", "vulnerabilities_age"),
+				Help: "Number of findings across the matched projects attributed no longer ago than the upper bound, in seconds.",
+			},
+			[]string{
+				"le",
+			},
+		)
+		distinctVulnerabilities = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "portfolio", "distinct_vulnerabilities"),
+				Help: "Number of distinct vulnerabilities across the findings of the matched projects, by severity.",
+			},
+			[]string{
+				"severity",
+			},
+		)
+		affectedProjects = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "vulnerability", "affected_projects"),
+				Help: "Number of matched projects affected by a vulnerability.",
+			},
+			[]string{
+				"vuln_id",
+				"source",
+				"severity",
+			},
+		)
+		tagVulnerabilities = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "tag", "vulnerabilities"),
+				Help: "Number of vulnerabilities across the projects with a tag, by severity.",
+			},
+			[]string{
+				"tag",
+				"severity",
+			},
+		)
+		projects = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "", "projects"),
+				Help: "Number of projects, by classifier and active state.",
+			},
+			[]string{
+				"classifier",
+				"active",
+			},
+		)
+		projectLimitExceeded = prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "exporter", "project_limit_exceeded"),
+				Help: "Whether more projects matched the configured filters than the maximum allowed during the last poll.",
+			},
+		)
+		projectsScraped = prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "exporter", "projects_scraped"),
+				Help: "Number of projects matched by the configured filters during the last poll.",
+			},
+		)
+		refreshShard = prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "exporter", "refresh_shard"),
+				Help: "The shard of projects whose findings were refreshed during the last poll.",
+			},
+		)
+		projectScrapeDuration = prometheus.NewSummary(
+			prometheus.SummaryOpts{
+				Name:       prometheus.BuildFQName(namespace, "exporter", "project_scrape_duration_seconds"),
+				Help:       "Time spent collecting the metrics of each project during the last poll, in seconds.",
+				Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+			},
+		)
+		paginationMismatch = prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "exporter", "pagination_mismatch"),
+				Help: "Whether the number of projects returned by Dependency-Track differed from the total it reported during the last poll.",
+			},
+		)
+		policyViolationsScraped = prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "exporter", "policy_violations_scraped"),
+				Help: "Number of policy violations collected for the matched projects during the last poll.",
 			},
 		)
 	)
+	// The counter is kept across polls, unlike the other metrics
+	if e.projectCollectionErrors == nil {
+		e.projectCollectionErrors = prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: prometheus.BuildFQName(namespace, "exporter", "project_collection_errors"),
+				Help: "Number of errors collecting the metrics of individual projects.",
+			},
+		)
+	}
 	registry.MustRegister(
-		info,
-		vulnerabilities,
-		policyViolations,
-		lastBOMImport,
-		inheritedRiskScore,
+		projects,
+		projectsScraped,
+		projectLimitExceeded,
+		paginationMismatch,
+		projectScrapeDuration,
+		e.projectCollectionErrors,
 	)
+	if e.RefreshShards > 1 {
+		registry.MustRegister(refreshShard)
+	}
+	if e.collectorEnabled("project") {
+		registry.MustRegister(
+			info,
+			vulnerabilities,
+			findings,
+			findingsTotal,
+			findingsSuppressed,
+			policyViolationsAudited,
+			lastBOMImport,
+			active,
+			hasBOM,
+			inheritedRiskScore,
+			metricsLastMeasurement,
+			metricsMissing,
+			children,
+			versions,
+		)
+		if e.CollectFindings {
+			registry.MustRegister(
+				finding,
+				findingAnalysis,
+				maxCVSS,
+				oldestFindingAge,
+				vulnerabilitiesAge,
+				distinctVulnerabilities,
+			)
+			if e.RecentSuppressionWindow > 0 && e.IncludeSuppressedFindings {
+				registry.MustRegister(findingsSuppressedRecent)
+			}
+		}
+		if e.MetricsMaxAge > 0 {
+			registry.MustRegister(metricsStale)
+		}
+		if e.StaleBOMThreshold > 0 {
+			registry.MustRegister(bomStale)
+		}
+		if e.CollectProjectTags {
+			registry.MustRegister(tag)
+		}
+		if len(e.AggregateTags) > 0 {
+			registry.MustRegister(tagVulnerabilities)
+		}
+		if e.CollectFindingsBySource {
+			registry.MustRegister(findingsBySource)
+		}
+		if e.CollectVulnerabilitiesDetailed {
+			registry.MustRegister(vulnerabilitiesDetailed)
+		}
+		if e.CollectAffectedProjects {
+			registry.MustRegister(affectedProjects)
+		}
+		if e.CollectComponents {
+			registry.MustRegister(componentsByType)
+		}
+		if e.CollectLicenses {
+			registry.MustRegister(licenses, distinctLicenses)
+		}
+	}
+	if e.collectorEnabled("violation") {
+		// The counter is kept across polls, unlike the other metrics
+		if e.newPolicyViolations == nil {
+			e.newPolicyViolations = prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: prometheus.BuildFQName(namespace, "project", "new_policy_violations"),
+					Help: "Number of policy violations that appeared for a project since the exporter started.",
+				},
+				[]string{
+					"uuid",
+					"name",
+					"version",
+					"type",
+				},
+			)
+		}
+		registry.MustRegister(
+			policyViolations,
+			portfolioPolicyViolations,
+			suppressedPolicyViolations,
+			policyViolationsScraped,
+			e.newPolicyViolations,
+		)
+	}
 
-	matchedProjects := make(map[string]struct{})
+	type projectsKey struct {
+		classifier string
+		active     string
+	}
+	type tagSeverityKey struct {
+		tag      string
+		severity string
+	}
+	type vulnerabilityKey struct {
+		vulnID   string
+		source   string
+		severity string
+	}
+	type projectRef struct {
+		name    string
+		version string
+	}
+
+	var (
+		matchedProjects = make(map[string]projectRef)
+		projectCounts   = make(map[projectsKey]int)
+		// Children are counted from the parent references of the listed
+		// projects, which saves an API call per project
+		childCounts = make(map[string]int)
+		tagCounts   = make(map[tagSeverityKey]int)
+		// Findings are fetched once per project and shared by the metrics
+		// derived from them
+		sourceCounts = make(map[string]int)
+		ageBuckets   = e.FindingAgeBuckets
+		// The severity of every vulnerability found in any of the projects,
+		// which grows with the number of distinct vulnerabilities rather than
+		// the number of findings
+		distinctSeverities = make(map[uuid.UUID]string)
+		affectedCounts     = make(map[vulnerabilityKey]int)
+		licenseCounts      = make(map[string]int)
+	)
+	if len(ageBuckets) == 0 {
+		ageBuckets = DefaultFindingAgeBuckets
+	}
+	// The number of findings in each bucket, the last of which holds the
+	// findings older than every bound
+	ageCounts := make([]int, len(ageBuckets)+1)
+
+	var (
+		pagination paginationCheck
+		cache      = make(map[uuid.UUID][]*cachedFinding)
+	)
+	collectProject := func(project dtrack.Project) error {
+		if e.RefreshMetrics && e.collectorEnabled("project") {
+			// The current metrics can still be reported if the refresh fails
+			if err := e.Client.Metrics.RefreshProjectMetrics(ctx, project.UUID); err != nil {
+				e.Logger.Warn("Error refreshing project metrics", "uuid", project.UUID, "name", project.Name, "version", project.Version, "err", err)
+			}
+		}
+		if sample := debugSampleFrom(ctx); sample != nil && len(sample.Projects) < debugSampleSize {
+			sample.Projects = append(sample.Projects, project)
+		}
 
-	err := e.forEachProject(ctx, func(project dtrack.Project) error {
 		projectUUID := project.UUID.String()
-		matchedProjects[projectUUID] = struct{}{}
+		matchedProjects[projectUUID] = projectRef{
+			name:    project.Name,
+			version: project.Version,
+		}
+		projectCounts[projectsKey{
+			classifier: project.Classifier,
+			active:     strconv.FormatBool(project.Active),
+		}]++
+		if project.ParentRef != nil {
+			childCounts[project.ParentRef.UUID.String()]++
+		}
+
+		infoValues := make([]string, len(infoLabels))
+		for i, label := range infoLabels[:numInfoLabels] {
+			infoValues[i] = projectInfoLabels[label](project)
+		}
+		for i, key := range e.TagLabels {
+			infoValues[numInfoLabels+i] = tagLabelValue(project, key)
+		}
+		info.WithLabelValues(infoValues...).Set(1)
 
-		var tags []string
 		for _, t := range project.Tags {
-			tags = append(tags, t.Name)
+			tag.WithLabelValues(
+				projectUUID,
+				project.Name,
+				project.Version,
+				t.Name,
+			).Set(1)
+		}
+
+		// Projects whose metrics were never computed report zeros, which would
+		// be mistaken for a clean project, so their metrics are left out
+		var missing float64
+		if project.Metrics.LastOccurrence == 0 {
+			missing = 1
+		}
+		metricsMissing.WithLabelValues(
+			projectUUID,
+			project.Name,
+			project.Version,
+		).Set(missing)
+
+		if missing == 0 {
+			severities := projectSeverityCounts(project.Metrics)
+			for severity, v := range severities {
+				vulnerabilities.WithLabelValues(identity(
+					projectUUID,
+					project.Name,
+					project.Version,
+					severity,
+				)...).Set(float64(v))
+			}
+
+			// The metrics of collection projects are aggregated from their
+			// children, which are already counted
+			for _, t := range project.Tags {
+				if isCollection(project) || !slices.Contains(e.AggregateTags, t.Name) {
+					continue
+				}
+				for severity, v := range severities {
+					tagCounts[tagSeverityKey{tag: t.Name, severity: severity}] += v
+				}
+			}
+
+			findingsAudited := map[string]int{
+				"true":  project.Metrics.FindingsAudited,
+				"false": project.Metrics.FindingsUnaudited,
+			}
+			for audited, v := range findingsAudited {
+				findings.WithLabelValues(
+					projectUUID,
+					project.Name,
+					project.Version,
+					audited,
+				).Set(float64(v))
+			}
+
+			findingsTotal.WithLabelValues(
+				projectUUID,
+				project.Name,
+				project.Version,
+			).Set(float64(project.Metrics.FindingsTotal))
+
+			findingsSuppressed.WithLabelValues(
+				projectUUID,
+				project.Name,
+				project.Version,
+			).Set(float64(project.Metrics.Suppressed))
+
+			policyViolationsAuditedStates := map[string]int{
+				"true":  project.Metrics.PolicyViolationsAudited,
+				"false": project.Metrics.PolicyViolationsUnaudited,
+			}
+			for audited, v := range policyViolationsAuditedStates {
+				policyViolationsAudited.WithLabelValues(
+					projectUUID,
+					project.Name,
+					project.Version,
+					audited,
+				).Set(float64(v))
+			}
 		}
 
-		info.WithLabelValues(
+		lastBOMImport.WithLabelValues(identity(
 			projectUUID,
 			project.Name,
 			project.Version,
-			project.Classifier,
-			strconv.FormatBool(project.Active),
-			strings.Join(tags, ","),
-		).Set(1)
+		)...).Set(float64(project.LastBOMImport))
+
+		var isActive float64
+		if project.Active {
+			isActive = 1
+		}
+		active.WithLabelValues(projectUUID).Set(isActive)
 
-		severities := map[string]int{
-			"CRITICAL":   project.Metrics.Critical,
-			"HIGH":       project.Metrics.High,
-			"MEDIUM":     project.Metrics.Medium,
-			"LOW":        project.Metrics.Low,
-			"UNASSIGNED": project.Metrics.Unassigned,
+		var bom float64
+		if project.LastBOMImport != 0 {
+			bom = 1
 		}
-		for severity, v := range severities {
-			vulnerabilities.WithLabelValues(
+		hasBOM.WithLabelValues(identity(
+			projectUUID,
+			project.Name,
+			project.Version,
+		)...).Set(bom)
+
+		if missing == 0 {
+			inheritedRiskScore.WithLabelValues(identity(
+				projectUUID,
+				project.Name,
+				project.Version,
+			)...).Set(project.Metrics.InheritedRiskScore)
+
+			// Dependency-Track reports timestamps in milliseconds
+			metricsLastMeasurement.WithLabelValues(
 				projectUUID,
 				project.Name,
 				project.Version,
-				severity,
-			).Set(float64(v))
+			).Set(float64(project.Metrics.LastOccurrence) / 1000)
+		}
+
+		var stale float64
+		if time.Since(time.UnixMilli(int64(project.Metrics.LastOccurrence))) > e.MetricsMaxAge {
+			stale = 1
 		}
-		lastBOMImport.WithLabelValues(
+		metricsStale.WithLabelValues(
 			projectUUID,
 			project.Name,
 			project.Version,
-		).Set(float64(project.LastBOMImport))
+		).Set(stale)
 
-		inheritedRiskScore.WithLabelValues(
+		// Dependency-Track reports timestamps in milliseconds
+		var staleBOM float64
+		if project.LastBOMImport == 0 || time.Since(time.UnixMilli(int64(project.LastBOMImport))) > e.StaleBOMThreshold {
+			staleBOM = 1
+		}
+		bomStale.WithLabelValues(
 			projectUUID,
 			project.Name,
 			project.Version,
-		).Set(project.Metrics.InheritedRiskScore)
+		).Set(staleBOM)
 
 		// Initialize all the possible violation series with a 0 value so that it
 		// properly records increments from 0 -> 1.
 		// Note: This accounts for 72 series per project.
-		if e.InitializeViolationMetrics {
+		if e.InitializeViolationMetrics && e.collectorEnabled("violation") {
 			for _, possibleType := range []string{"LICENSE", "OPERATIONAL", "SECURITY"} {
-				for _, possibleState := range []string{"INFO", "WARN", "FAIL"} {
+				suppressedPolicyViolations.WithLabelValues(identity(
+					projectUUID,
+					project.Name,
+					project.Version,
+					possibleType,
+				)...).Set(0)
+				for _, possibleState := range ViolationStates {
+					if !e.violationStateEnabled(possibleState) {
+						continue
+					}
 					for _, possibleAnalysis := range []dtrack.ViolationAnalysisState{
 						dtrack.ViolationAnalysisStateApproved,
 						dtrack.ViolationAnalysisStateRejected,
@@ -289,7 +1839,7 @@ func (e *Exporter) collectProjectMetrics(ctx context.Context, registry *promethe
 						"",
 					} {
 						for _, possibleSuppressed := range []string{"true", "false"} {
-							policyViolations.WithLabelValues(
+							policyViolations.WithLabelValues(identity(
 								projectUUID,
 								project.Name,
 								project.Version,
@@ -297,23 +1847,287 @@ func (e *Exporter) collectProjectMetrics(ctx context.Context, registry *promethe
 								possibleState,
 								string(possibleAnalysis),
 								possibleSuppressed,
-							).Set(0)
+							)...).Set(0)
+						}
+					}
+				}
+			}
+		}
+
+		if (e.CollectFindings || e.CollectFindingsBySource || e.CollectVulnerabilitiesDetailed || e.CollectAffectedProjects) && e.collectorEnabled("project") {
+			var (
+				projectMaxCVSS     float64
+				oldestAttributedOn int
+				suppressedRecent   int
+				// A vulnerability can affect several components of a
+				// project, but the project is only counted once
+				projectVulnerabilities = make(map[vulnerabilityKey]struct{})
+			)
+			err := e.forEachCachedFinding(ctx, project, cache, func(cf *cachedFinding) error {
+				f := cf.Finding
+				if e.CollectFindings && e.RecentSuppressionWindow > 0 && f.Analysis.Suppressed {
+					// The suppression time of a cached finding is only looked
+					// up once, when its shard is refreshed
+					if !cf.suppressionChecked {
+						suppressedOn, err := e.suppressedOn(ctx, project, f)
+						if err != nil {
+							// The finding is only missing from the count, and
+							// is looked up again by the next poll
+							e.Logger.Warn("Error getting the analysis of a suppressed finding", "uuid", project.UUID, "component", f.Component.UUID, "vulnerability", f.Vulnerability.UUID, "err", err)
+						} else {
+							cf.suppressedOn = suppressedOn
+							cf.suppressionChecked = true
 						}
 					}
+					if cf.suppressionChecked && !cf.suppressedOn.IsZero() && time.Since(cf.suppressedOn) <= e.RecentSuppressionWindow {
+						suppressedRecent++
+					}
+				}
+				if e.CollectFindings {
+					projectMaxCVSS = max(projectMaxCVSS, cvssScore(f))
+					if isUnaudited(f) && f.Attribution.AttributedOn > 0 && (oldestAttributedOn == 0 || f.Attribution.AttributedOn < oldestAttributedOn) {
+						oldestAttributedOn = f.Attribution.AttributedOn
+					}
+					distinctSeverities[f.Vulnerability.UUID] = f.Vulnerability.Severity
+					// Findings without an attribution date have no age
+					if f.Attribution.AttributedOn > 0 {
+						age := time.Since(time.UnixMilli(int64(f.Attribution.AttributedOn)))
+						i, _ := slices.BinarySearch(ageBuckets, age)
+						ageCounts[i]++
+					}
+					finding.WithLabelValues(
+						projectUUID,
+						project.Name,
+						project.Version,
+						f.Vulnerability.VulnID,
+						f.Vulnerability.Source,
+						f.Vulnerability.Severity,
+						f.Analysis.State,
+						strconv.FormatBool(f.Analysis.Suppressed),
+					).Set(1)
+					findingAnalysis.WithLabelValues(
+						projectUUID,
+						project.Name,
+						project.Version,
+						f.Analysis.State,
+					).Inc()
+				}
+				if e.CollectVulnerabilitiesDetailed {
+					vulnerabilitiesDetailed.WithLabelValues(
+						projectUUID,
+						project.Name,
+						project.Version,
+						f.Vulnerability.Severity,
+						f.Analysis.State,
+					).Inc()
+				}
+				if e.CollectAffectedProjects {
+					projectVulnerabilities[vulnerabilityKey{
+						vulnID:   f.Vulnerability.VulnID,
+						source:   f.Vulnerability.Source,
+						severity: f.Vulnerability.Severity,
+					}] = struct{}{}
+				}
+				sourceCounts[f.Vulnerability.Source]++
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for k := range projectVulnerabilities {
+				affectedCounts[k]++
+			}
+			maxCVSS.WithLabelValues(
+				projectUUID,
+				project.Name,
+				project.Version,
+			).Set(projectMaxCVSS)
+			findingsSuppressedRecent.WithLabelValues(
+				projectUUID,
+				project.Name,
+				project.Version,
+			).Set(float64(suppressedRecent))
+			// Projects without unaudited findings have no age to report
+			if oldestAttributedOn > 0 {
+				oldestFindingAge.WithLabelValues(
+					projectUUID,
+					project.Name,
+					project.Version,
+				).Set(time.Since(time.UnixMilli(int64(oldestAttributedOn))).Seconds())
+			}
+		}
+
+		// The components are listed once per project and shared by the
+		// metrics derived from them
+		if (e.CollectComponents || e.CollectLicenses) && e.collectorEnabled("project") {
+			componentCounts := make(map[string]int)
+			err := forEach(ctx, e.PageSize, func(ctx context.Context, po dtrack.PageOptions) (dtrack.Page[dtrack.Component], error) {
+				return e.Client.Component.GetAll(ctx, project.UUID, po, dtrack.ComponentFilterOptions{})
+			}, func(c dtrack.Component) error {
+				componentCounts[c.Classifier]++
+				if license := componentLicense(c); license != "" {
+					licenseCounts[license]++
 				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for componentType, v := range componentCounts {
+				componentsByType.WithLabelValues(identity(
+					projectUUID,
+					project.Name,
+					project.Version,
+					componentType,
+				)...).Set(float64(v))
 			}
 		}
 
+		return nil
+	}
+	err := e.forEachProject(ctx, &pagination, func(project dtrack.Project) error {
+		if e.MaxProjects > 0 && len(matchedProjects) >= e.MaxProjects {
+			return errProjectLimitExceeded
+		}
+
+		// A single project failing shouldn't lose the metrics of all the
+		// others, so errors are only returned if the poll itself was cancelled
+		start := time.Now()
+		err := recoverProject(project, collectProject)
+		projectScrapeDuration.Observe(time.Since(start).Seconds())
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			e.Logger.Error("Error collecting project metrics, skipping", "uuid", project.UUID, "name", project.Name, "version", project.Version, "err", err)
+			e.projectCollectionErrors.Inc()
+		}
 		return nil
 	})
-	if err != nil {
+	if e.RefreshShards > 1 {
+		refreshShard.Set(float64(e.refreshShard))
+		// The cache is only replaced once every project was visited, and the
+		// shard is refreshed again otherwise, so that the projects a pass
+		// didn't reach keep their findings
+		if err == nil {
+			// Projects that are no longer matched are dropped from the cache
+			e.findingsCache = cache
+			e.Logger.Debug("Refreshed findings for shard", "shard", e.refreshShard, "shards", e.RefreshShards)
+			e.refreshShard = (e.refreshShard + 1) % e.RefreshShards
+		}
+	}
+	if errors.Is(err, errProjectLimitExceeded) {
+		e.Logger.Warn("Stopped collecting project metrics after reaching the project limit", "max_projects", e.MaxProjects)
+		projectLimitExceeded.Set(1)
+	} else if err != nil {
+		// The violation pass depends on the projects, so it fails as well
+		e.recordCollector("project", start, err)
+		e.recordCollector("violation", start, err)
 		return err
+	} else if pagination.returned != pagination.reported {
+		// Dependency-Track is known to report inconsistent totals while BOMs
+		// are being imported, in which case some projects may be missing
+		e.Logger.Warn("Number of projects returned by Dependency-Track differs from the reported total", "returned", pagination.returned, "reported", pagination.reported)
+		paginationMismatch.Set(1)
+	}
+	projectsScraped.Set(float64(len(matchedProjects)))
+	for k, v := range projectCounts {
+		projects.WithLabelValues(k.classifier, k.active).Set(float64(v))
+	}
+	for k, v := range tagCounts {
+		tagVulnerabilities.WithLabelValues(k.tag, k.severity).Set(float64(v))
+	}
+	for source, v := range sourceCounts {
+		findingsBySource.WithLabelValues(source).Set(float64(v))
+	}
+	for license, v := range licenseCounts {
+		licenses.WithLabelValues(license).Set(float64(v))
+	}
+	distinctLicenses.Set(float64(len(licenseCounts)))
+	affected := slices.Collect(maps.Keys(affectedCounts))
+	if e.AffectedProjectsLimit > 0 && len(affected) > e.AffectedProjectsLimit {
+		// Ties are broken by ID, so that the same vulnerabilities are
+		// reported from one poll to the next
+		slices.SortFunc(affected, func(a, b vulnerabilityKey) int {
+			if c := cmp.Compare(affectedCounts[b], affectedCounts[a]); c != 0 {
+				return c
+			}
+			return cmp.Or(cmp.Compare(a.vulnID, b.vulnID), cmp.Compare(a.source, b.source))
+		})
+		affected = affected[:e.AffectedProjectsLimit]
+	}
+	for _, k := range affected {
+		affectedProjects.WithLabelValues(k.vulnID, k.source, k.severity).Set(float64(affectedCounts[k]))
+	}
+	severityCounts := make(map[string]int)
+	for _, severity := range distinctSeverities {
+		severityCounts[severity]++
+	}
+	for severity, v := range severityCounts {
+		distinctVulnerabilities.WithLabelValues(severity).Set(float64(v))
+	}
+	// The buckets are cumulative, like those of a histogram
+	var cumulative int
+	for i, v := range ageCounts {
+		cumulative += v
+		le := "+Inf"
+		if i < len(ageBuckets) {
+			le = strconv.FormatFloat(ageBuckets[i].Seconds(), 'f', -1, 64)
+		}
+		vulnerabilitiesAge.WithLabelValues(le).Set(float64(cumulative))
+	}
+	// Every version of a project is a separate project in Dependency-Track,
+	// sharing its name
+	versionCounts := make(map[string]int)
+	for projectUUID, ref := range matchedProjects {
+		children.WithLabelValues(
+			projectUUID,
+			ref.name,
+			ref.version,
+		).Set(float64(childCounts[projectUUID]))
+		versionCounts[ref.name]++
+	}
+	for name, v := range versionCounts {
+		versions.WithLabelValues(name).Set(float64(v))
+	}
+
+	e.recordCollector("project", start, nil)
+
+	if !e.collectorEnabled("violation") {
+		return nil
+	}
+
+	type violationKey struct {
+		violationType string
+		state         string
+		suppressed    string
 	}
 
+	start = time.Now()
+	seenPolicyViolations := make(map[uuid.UUID]struct{})
+	violationCounts := make(map[violationKey]int)
+	// New violations are only counted once the pass succeeds, since a failed
+	// pass doesn't replace the violations seen by the previous one
+	var newPolicyViolations [][]string
 	err = e.forEachPolicyViolation(ctx, func(violation dtrack.PolicyViolation) error {
 		if _, ok := matchedProjects[violation.Project.UUID.String()]; !ok {
 			return nil
 		}
+		if !e.violationStateEnabled(string(violation.PolicyCondition.Policy.ViolationState)) {
+			return nil
+		}
+		seenPolicyViolations[violation.UUID] = struct{}{}
+		// Every violation is new on the first poll, so none are counted
+		if e.seenPolicyViolations != nil {
+			if _, ok := e.seenPolicyViolations[violation.UUID]; !ok {
+				newPolicyViolations = append(newPolicyViolations, []string{
+					violation.Project.UUID.String(),
+					violation.Project.Name,
+					violation.Project.Version,
+					violation.Type,
+				})
+			}
+		}
 		var (
 			analysisState string
 			suppressed    string = "false"
@@ -321,8 +2135,16 @@ func (e *Exporter) collectProjectMetrics(ctx context.Context, registry *promethe
 		if analysis := violation.Analysis; analysis != nil {
 			analysisState = string(analysis.State)
 			suppressed = strconv.FormatBool(analysis.Suppressed)
+			if analysis.Suppressed {
+				suppressedPolicyViolations.WithLabelValues(identity(
+					violation.Project.UUID.String(),
+					violation.Project.Name,
+					violation.Project.Version,
+					violation.Type,
+				)...).Inc()
+			}
 		}
-		policyViolations.WithLabelValues(
+		policyViolations.WithLabelValues(identity(
 			violation.Project.UUID.String(),
 			violation.Project.Name,
 			violation.Project.Version,
@@ -330,28 +2152,173 @@ func (e *Exporter) collectProjectMetrics(ctx context.Context, registry *promethe
 			string(violation.PolicyCondition.Policy.ViolationState),
 			analysisState,
 			suppressed,
-		).Inc()
+		)...).Inc()
+		violationCounts[violationKey{
+			violationType: violation.Type,
+			state:         string(violation.PolicyCondition.Policy.ViolationState),
+			suppressed:    suppressed,
+		}]++
+		policyViolationsScraped.Inc()
 		return nil
 	})
+	e.recordCollector("violation", start, err)
 	if err != nil {
 		return err
 	}
+	e.seenPolicyViolations = seenPolicyViolations
+	if e.newPolicyViolationProjects == nil {
+		e.newPolicyViolationProjects = make(map[string]struct{})
+	}
+	for _, values := range newPolicyViolations {
+		e.newPolicyViolations.WithLabelValues(values...).Inc()
+		e.newPolicyViolationProjects[values[0]] = struct{}{}
+	}
+	// The counter outlives the polls, so the series of projects that were
+	// removed or no longer match the filters are deleted
+	for projectUUID := range e.newPolicyViolationProjects {
+		if _, ok := matchedProjects[projectUUID]; !ok {
+			e.newPolicyViolations.DeletePartialMatch(prometheus.Labels{"uuid": projectUUID})
+			delete(e.newPolicyViolationProjects, projectUUID)
+		}
+	}
+	for k, v := range violationCounts {
+		portfolioPolicyViolations.WithLabelValues(k.violationType, k.state, k.suppressed).Set(float64(v))
+	}
 
 	return nil
 }
 
-func (e *Exporter) forEachProject(ctx context.Context, fn func(dtrack.Project) error) error {
+func (e *Exporter) collectPolicyMetrics(ctx context.Context, registry prometheus.Registerer) error {
+	namespace := e.namespace()
+	var (
+		info = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "policy", "info"),
+				Help: "Policy information.",
+			},
+			[]string{
+				"uuid",
+				"name",
+				"operator",
+				"violation_state",
+			},
+		)
+		conditions = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "policy", "conditions"),
+				Help: "Number of conditions configured for a policy.",
+			},
+			[]string{
+				"uuid",
+				"name",
+			},
+		)
+	)
+	registry.MustRegister(
+		info,
+		conditions,
+	)
+
+	return e.forEachPolicy(ctx, func(policy dtrack.Policy) error {
+		policyUUID := policy.UUID.String()
+
+		info.WithLabelValues(
+			policyUUID,
+			policy.Name,
+			string(policy.Operator),
+			string(policy.ViolationState),
+		).Set(1)
+
+		conditions.WithLabelValues(
+			policyUUID,
+			policy.Name,
+		).Set(float64(len(policy.PolicyConditions)))
+
+		return nil
+	})
+}
+
+// paginationCheck records the total number of items Dependency-Track reports
+// for paginated requests and the number of items it actually returns
+type paginationCheck struct {
+	reported int
+	returned int
+}
+
+// forEachProject calls fn for every project matching the configured filters.
+// The number of projects returned by Dependency-Track before filtering is
+// recorded in pagination, if it isn't nil.
+func (e *Exporter) forEachProject(ctx context.Context, pagination *paginationCheck, fn func(dtrack.Project) error) error {
+	if e.project != nil {
+		return fn(*e.project)
+	}
+
+	if len(e.ProjectClassifiers) > 0 {
+		next := fn
+		fn = func(p dtrack.Project) error {
+			if !e.matchesClassifier(p) {
+				return nil
+			}
+			return next(p)
+		}
+	}
+
+	if e.OnlyProjectsWithViolations {
+		next := fn
+		fn = func(p dtrack.Project) error {
+			if !hasIssues(p) {
+				return nil
+			}
+			return next(p)
+		}
+	}
+
+	if len(e.ProjectUUIDs) > 0 {
+		return e.forEachProjectByUUID(ctx, fn)
+	}
+
+	if pagination == nil {
+		pagination = &paginationCheck{}
+	}
+	count := func(fetch func(context.Context, dtrack.PageOptions) (dtrack.Page[dtrack.Project], error)) func(context.Context, dtrack.PageOptions) (dtrack.Page[dtrack.Project], error) {
+		return func(ctx context.Context, po dtrack.PageOptions) (dtrack.Page[dtrack.Project], error) {
+			page, err := fetch(ctx, po)
+			if err != nil {
+				return page, err
+			}
+			if po.PageNumber == 1 {
+				pagination.reported += page.TotalCount
+			}
+			pagination.returned += len(page.Items)
+			return page, nil
+		}
+	}
+
 	if len(e.ProjectTags) == 0 {
-		return dtrack.ForEach(func(po dtrack.PageOptions) (dtrack.Page[dtrack.Project], error) {
+		return forEach(ctx, e.PageSize, count(func(ctx context.Context, po dtrack.PageOptions) (dtrack.Page[dtrack.Project], error) {
 			return e.Client.Project.GetAll(ctx, po)
-		}, fn)
+		}), fn)
+	}
+
+	// The client puts tags in the request path as is, and Dependency-Track
+	// can't match a slash in a path parameter even when it's encoded, so
+	// hierarchical tags like team/payments are filtered on locally instead
+	if slices.ContainsFunc(e.ProjectTags, func(tag string) bool { return strings.Contains(tag, "/") }) {
+		return forEach(ctx, e.PageSize, count(func(ctx context.Context, po dtrack.PageOptions) (dtrack.Page[dtrack.Project], error) {
+			return e.Client.Project.GetAll(ctx, po)
+		}), func(p dtrack.Project) error {
+			if !e.matchesTags(p) {
+				return nil
+			}
+			return fn(p)
+		})
 	}
 
 	seen := make(map[string]struct{})
 	for _, tag := range e.ProjectTags {
-		err := dtrack.ForEach(func(po dtrack.PageOptions) (dtrack.Page[dtrack.Project], error) {
+		err := forEach(ctx, e.PageSize, count(func(ctx context.Context, po dtrack.PageOptions) (dtrack.Page[dtrack.Project], error) {
 			return e.Client.Project.GetAllByTag(ctx, tag, false, false, po)
-		}, func(p dtrack.Project) error {
+		}), func(p dtrack.Project) error {
 			id := p.UUID.String()
 			if _, ok := seen[id]; ok {
 				return nil
@@ -366,15 +2333,319 @@ func (e *Exporter) forEachProject(ctx context.Context, fn func(dtrack.Project) e
 	return nil
 }
 
+// forEachProjectByUUID fetches the configured projects directly, rather than
+// listing the whole portfolio. Projects must also match the tag filter, if one
+// is configured.
+func (e *Exporter) forEachProjectByUUID(ctx context.Context, fn func(dtrack.Project) error) error {
+	for _, id := range e.ProjectUUIDs {
+		p, err := e.Client.Project.Get(ctx, id)
+		if err != nil {
+			var apiErr *dtrack.APIError
+			if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+				e.Logger.Warn("Project not found, skipping", "uuid", id)
+				continue
+			}
+			return fmt.Errorf("getting project %s: %w", id, err)
+		}
+		if len(e.ProjectTags) > 0 && !e.matchesTags(p) {
+			continue
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Exporter) matchesTags(p dtrack.Project) bool {
+	for _, tag := range p.Tags {
+		if slices.Contains(e.ProjectTags, tag.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasIssues returns whether the metrics of a project report any policy
+// violation or vulnerability
+func hasIssues(p dtrack.Project) bool {
+	return p.Metrics.PolicyViolationsTotal > 0 || p.Metrics.Vulnerabilities > 0
+}
+
+func (e *Exporter) matchesClassifier(p dtrack.Project) bool {
+	for _, classifier := range e.ProjectClassifiers {
+		if strings.EqualFold(classifier, p.Classifier) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordCollector records a run of the named collector in CollectorStatus, if
+// it's enabled
+func (e *Exporter) recordCollector(name string, start time.Time, err error) {
+	if e.CollectorStatus == nil || !e.collectorEnabled(name) {
+		return
+	}
+	e.CollectorStatus.record(name, start, err)
+}
+
+// gatherer returns the gatherer of the metrics that outlive a poll
+func (e *Exporter) gatherer() prometheus.Gatherer {
+	if e.Gatherer != nil {
+		return e.Gatherer
+	}
+	return prometheus.DefaultGatherer
+}
+
+// namespace returns the namespace of the exported metrics
+func (e *Exporter) namespace() string {
+	return namespaceOrDefault(e.MetricNamespace)
+}
+
+// collectorEnabled returns whether the named collector should run. All
+// collectors run when none are configured.
+func (e *Exporter) collectorEnabled(name string) bool {
+	return len(e.Collectors) == 0 || slices.Contains(e.Collectors, name)
+}
+
+// projectScopeEnabled returns whether any collector polled with the projects
+// is enabled
+func (e *Exporter) projectScopeEnabled() bool {
+	return e.collectorEnabled("project") || e.collectorEnabled("violation") || e.CollectPolicies
+}
+
+// violationStateEnabled returns whether policy violations in the given state
+// should be collected
+func (e *Exporter) violationStateEnabled(state string) bool {
+	return len(e.ViolationStates) == 0 || slices.Contains(e.ViolationStates, state)
+}
+
 func (e *Exporter) forEachPolicyViolation(ctx context.Context, fn func(dtrack.PolicyViolation) error) error {
-	return dtrack.ForEach(func(po dtrack.PageOptions) (dtrack.Page[dtrack.PolicyViolation], error) {
+	if e.project != nil {
+		return forEach(ctx, e.PageSize, func(ctx context.Context, po dtrack.PageOptions) (dtrack.Page[dtrack.PolicyViolation], error) {
+			return e.Client.PolicyViolation.GetAllForProject(ctx, e.project.UUID, true, po)
+		}, fn)
+	}
+	return forEach(ctx, e.PageSize, func(ctx context.Context, po dtrack.PageOptions) (dtrack.Page[dtrack.PolicyViolation], error) {
 		return e.Client.PolicyViolation.GetAll(ctx, true, po)
 	}, fn)
 }
 
+func (e *Exporter) forEachPolicy(ctx context.Context, fn func(dtrack.Policy) error) error {
+	return forEach(ctx, e.PageSize, func(ctx context.Context, po dtrack.PageOptions) (dtrack.Page[dtrack.Policy], error) {
+		return e.Client.Policy.GetAll(ctx, po)
+	}, fn)
+}
+
+func (e *Exporter) forEachFinding(ctx context.Context, project dtrack.Project, fn func(dtrack.Finding) error) error {
+	return forEach(ctx, e.PageSize, func(ctx context.Context, po dtrack.PageOptions) (dtrack.Page[dtrack.Finding], error) {
+		return e.Client.Finding.GetAll(ctx, project.UUID, e.IncludeSuppressedFindings, po)
+	}, fn)
+}
+
+// cachedFinding is a finding in the findings cache, along with what's looked up
+// about it with separate API calls, so that the lookups are cached as well
+type cachedFinding struct {
+	dtrack.Finding
+	// suppressedOn is when the finding was suppressed, once suppressionChecked
+	suppressedOn       time.Time
+	suppressionChecked bool
+}
+
+// forEachCachedFinding calls fn for every finding of the project. When projects
+// are refreshed in shards, the findings of projects outside of the current
+// shard are read from the cache of the previous poll, and the findings that
+// are read are stored in cache for the next one. Changes fn makes to the
+// findings are kept in the cache.
+func (e *Exporter) forEachCachedFinding(ctx context.Context, project dtrack.Project, cache map[uuid.UUID][]*cachedFinding, fn func(*cachedFinding) error) error {
+	if e.RefreshShards <= 1 {
+		return e.forEachFinding(ctx, project, func(f dtrack.Finding) error {
+			return fn(&cachedFinding{Finding: f})
+		})
+	}
+
+	// Projects that haven't been cached yet, for instance on the first poll,
+	// are always fetched
+	if cached, ok := e.findingsCache[project.UUID]; ok && projectShard(project.UUID, e.RefreshShards) != e.refreshShard {
+		cache[project.UUID] = cached
+		for _, f := range cached {
+			if err := fn(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	findings := []*cachedFinding{}
+	err := e.forEachFinding(ctx, project, func(f dtrack.Finding) error {
+		cf := &cachedFinding{Finding: f}
+		findings = append(findings, cf)
+		return fn(cf)
+	})
+	if err != nil {
+		return err
+	}
+	cache[project.UUID] = findings
+	return nil
+}
+
+// componentLicense returns the SPDX ID of the license of a component, when
+// Dependency-Track resolved it, or the license as declared in the BOM otherwise
+func componentLicense(c dtrack.Component) string {
+	if c.ResolvedLicense != nil && c.ResolvedLicense.LicenseID != "" {
+		return c.ResolvedLicense.LicenseID
+	}
+	return c.License
+}
+
+// suppressionComment is the comment Dependency-Track adds to the audit trail of
+// an analysis when its finding is suppressed
+const suppressionComment = "Suppressed"
+
+// suppressedOn returns when a finding was last suppressed, according to the
+// audit trail of its analysis. The finding API doesn't include the trail, so
+// it's fetched separately. It returns the zero time when the trail has no
+// record of the suppression.
+func (e *Exporter) suppressedOn(ctx context.Context, project dtrack.Project, f dtrack.Finding) (time.Time, error) {
+	analysis, err := e.Client.Analysis.Get(ctx, f.Component.UUID, project.UUID, f.Vulnerability.UUID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var latest int
+	for _, c := range analysis.Comments {
+		if c.Comment == suppressionComment && c.Timestamp > latest {
+			latest = c.Timestamp
+		}
+	}
+	if latest == 0 {
+		return time.Time{}, nil
+	}
+	return time.UnixMilli(int64(latest)), nil
+}
+
+// recoverProject calls fn for project, turning panics into errors
+func recoverProject(project dtrack.Project, fn func(dtrack.Project) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic collecting project: %v", r)
+		}
+	}()
+	return fn(project)
+}
+
+// isCollection reports whether the metrics of a project are aggregated from
+// its children rather than computed from its own components
+func isCollection(p dtrack.Project) bool {
+	return p.CollectionLogic != nil && *p.CollectionLogic != dtrack.CollectionLogicNone
+}
+
+// isUnaudited returns whether no analysis decision has been made for a finding
+func isUnaudited(f dtrack.Finding) bool {
+	return f.Analysis.State == "" || f.Analysis.State == string(dtrack.AnalysisStateNotSet)
+}
+
+// cvssScore returns the CVSS v3 base score of a finding, falling back to the v2
+// score for vulnerabilities that were only scored with CVSS v2
+func cvssScore(f dtrack.Finding) float64 {
+	if f.Vulnerability.CVSSV3BaseScore > 0 {
+		return f.Vulnerability.CVSSV3BaseScore
+	}
+	return f.Vulnerability.CVSSV2BaseScore
+}
+
+// maxConfigLabelLength is the length above which a list in the labels of
+// dependency_track_exporter_config is summarized
+const maxConfigLabelLength = 64
+
+// configInfo returns a gauge describing the effective configuration of the
+// exporter in its labels
+func (e *Exporter) configInfo() prometheus.Gauge {
+	collectMode := "full"
+	if e.RefreshShards > 1 {
+		collectMode = "incremental"
+	}
+	g := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: prometheus.BuildFQName(e.namespace(), "exporter", "config"),
+		Help: "The effective configuration of the exporter, set to 1.",
+		ConstLabels: prometheus.Labels{
+			"poll_interval":                e.pollInterval.String(),
+			"project_tags":                 summarizeList(e.ProjectTags),
+			"initialize_violation_metrics": strconv.FormatBool(e.InitializeViolationMetrics),
+			"collect_mode":                 collectMode,
+		},
+	})
+	g.Set(1)
+	return g
+}
+
+// summarizeList joins values with commas, or summarizes them by their number
+// and a hash when that would be too long for a label value
+func summarizeList(values []string) string {
+	s := strings.Join(values, ",")
+	if len(s) <= maxConfigLabelLength {
+		return s
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s))
+	return fmt.Sprintf("%d values, fnv32a:%08x", len(values), h.Sum32())
+}
+
+// projectShard returns the shard a project is refreshed in
+func projectShard(id uuid.UUID, shards int) int {
+	h := fnv.New32a()
+	_, _ = h.Write(id[:])
+	return int(h.Sum32() % uint32(shards))
+}
+
+// forEach calls fn for every item of a paginated API resource, retrying pages
+// that are rate limited by Dependency-Track. Pages are requested with the given
+// size, or the client's default when it's 0.
+func forEach[T any](ctx context.Context, pageSize int, fetch func(context.Context, dtrack.PageOptions) (dtrack.Page[T], error), fn func(T) error) error {
+	return dtrack.ForEach(func(po dtrack.PageOptions) (dtrack.Page[T], error) {
+		if pageSize > 0 {
+			po.PageSize = pageSize
+		}
+		return fetchPage(ctx, po, fetch)
+	}, fn)
+}
+
+// fetchPage fetches a single page, retrying when Dependency-Track responds with
+// 429 Too Many Requests. It waits for the duration of the Retry-After header,
+// as recorded by RetryAfterTransport, or defaultRetryAfter when it's absent. A
+// rate limited response is returned as is when waiting would exceed the
+// deadline of ctx.
+func fetchPage[T any](ctx context.Context, po dtrack.PageOptions, fetch func(context.Context, dtrack.PageOptions) (dtrack.Page[T], error)) (dtrack.Page[T], error) {
+	for attempt := 0; ; attempt++ {
+		var retryAfter time.Duration
+		page, err := fetch(withRetryAfter(ctx, &retryAfter), po)
+
+		var apiErr *dtrack.APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests || attempt >= maxRateLimitRetries {
+			return page, err
+		}
+
+		if retryAfter <= 0 {
+			retryAfter = defaultRetryAfter
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < retryAfter {
+			return page, err
+		}
+
+		timer := time.NewTimer(retryAfter)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return page, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
 func (e *Exporter) fetchProjects(ctx context.Context) ([]dtrack.Project, error) {
 	var projects []dtrack.Project
-	err := e.forEachProject(ctx, func(p dtrack.Project) error {
+	err := e.forEachProject(ctx, nil, func(p dtrack.Project) error {
 		projects = append(projects, p)
 		return nil
 	})
@@ -389,3 +2660,12 @@ func (e *Exporter) fetchPolicyViolations(ctx context.Context) ([]dtrack.PolicyVi
 	})
 	return violations, err
 }
+
+func (e *Exporter) fetchFindings(ctx context.Context, project dtrack.Project) ([]dtrack.Finding, error) {
+	var findings []dtrack.Finding
+	err := e.forEachFinding(ctx, project, func(f dtrack.Finding) error {
+		findings = append(findings, f)
+		return nil
+	})
+	return findings, err
+}
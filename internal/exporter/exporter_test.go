@@ -1,19 +1,28 @@
 package exporter
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	dtrack "github.com/DependencyTrack/client-go"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	versioncollector "github.com/prometheus/client_golang/prometheus/collectors/version"
 )
 
 func TestFetchProjects_Pagination(t *testing.T) {
@@ -115,6 +124,210 @@ func TestFetchProjectsByTag_Pagination(t *testing.T) {
 	}
 }
 
+func TestFetchProjectsByTag_SpecialCharacters(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	spaced := dtrack.Project{UUID: uuid.New(), Name: "spaced", Tags: []dtrack.Tag{{Name: "team payments"}}}
+	slashed := dtrack.Project{UUID: uuid.New(), Name: "slashed", Tags: []dtrack.Tag{{Name: "team/payments"}}}
+	other := dtrack.Project{UUID: uuid.New(), Name: "other", Tags: []dtrack.Tag{{Name: "team/billing"}}}
+
+	mux.HandleFunc("/api/v1/project/tag/", func(w http.ResponseWriter, r *http.Request) {
+		// The path is decoded by the server, so it matches the raw tag
+		if r.URL.Path != "/api/v1/project/tag/team payments" {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("X-Total-Count", "1")
+		w.Header().Set("Content-type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.Project{spaced})
+	})
+	mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", "3")
+		w.Header().Set("Content-type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.Project{spaced, slashed, other})
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+
+	for _, tc := range []struct {
+		tags []string
+		want []dtrack.Project
+	}{
+		{
+			tags: []string{"team payments"},
+			want: []dtrack.Project{spaced},
+		},
+		{
+			tags: []string{"team/payments"},
+			want: []dtrack.Project{slashed},
+		},
+		{
+			tags: []string{"team payments", "team/payments"},
+			want: []dtrack.Project{spaced, slashed},
+		},
+	} {
+		e := &Exporter{
+			Client:      client,
+			ProjectTags: tc.tags,
+		}
+
+		got, err := e.fetchProjects(context.Background())
+		if err != nil {
+			t.Fatalf("tags %q: unexpected error fetching projects: %s", tc.tags, err)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("tags %q: unexpected projects:\n%s", tc.tags, diff)
+		}
+	}
+}
+
+func TestFetchProjects_ClassifierFilter(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	application := dtrack.Project{UUID: uuid.New(), Name: "application", Classifier: "APPLICATION"}
+	projects := []dtrack.Project{
+		application,
+		{UUID: uuid.New(), Name: "library", Classifier: "LIBRARY"},
+		{UUID: uuid.New(), Name: "container", Classifier: "CONTAINER"},
+	}
+
+	mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(projects)))
+		w.Header().Set("Content-type", "application/json")
+		json.NewEncoder(w).Encode(projects)
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+	e := &Exporter{
+		Client:             client,
+		ProjectClassifiers: []string{"APPLICATION"},
+	}
+
+	gotProjects, err := e.fetchProjects(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error fetching projects: %s", err)
+	}
+
+	if diff := cmp.Diff([]dtrack.Project{application}, gotProjects); diff != "" {
+		t.Errorf("unexpected projects:\n%s", diff)
+	}
+}
+
+func TestFetchProjects_OnlyProjectsWithViolations(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	vulnerable := dtrack.Project{UUID: uuid.New(), Name: "vulnerable", Metrics: dtrack.ProjectMetrics{Vulnerabilities: 2}}
+	violating := dtrack.Project{UUID: uuid.New(), Name: "violating", Metrics: dtrack.ProjectMetrics{PolicyViolationsTotal: 1}}
+	projects := []dtrack.Project{
+		vulnerable,
+		{UUID: uuid.New(), Name: "clean"},
+		violating,
+	}
+
+	mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(projects)))
+		w.Header().Set("Content-type", "application/json")
+		json.NewEncoder(w).Encode(projects)
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+	e := &Exporter{
+		Client:                     client,
+		OnlyProjectsWithViolations: true,
+	}
+
+	gotProjects, err := e.fetchProjects(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error fetching projects: %s", err)
+	}
+
+	if diff := cmp.Diff([]dtrack.Project{vulnerable, violating}, gotProjects); diff != "" {
+		t.Errorf("unexpected projects:\n%s", diff)
+	}
+}
+
+func TestFetchProjects_UUIDs(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	tagged := dtrack.Project{UUID: uuid.New(), Name: "tagged", Tags: []dtrack.Tag{{Name: "prod"}}}
+	untagged := dtrack.Project{UUID: uuid.New(), Name: "untagged"}
+
+	for _, p := range []dtrack.Project{tagged, untagged} {
+		mux.HandleFunc("/api/v1/project/"+p.UUID.String(), func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-type", "application/json")
+			json.NewEncoder(w).Encode(p)
+		})
+	}
+
+	// Listing the portfolio should never be necessary
+	mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to list projects")
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+	e := &Exporter{
+		Client:       client,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		ProjectTags:  []string{"prod"},
+		ProjectUUIDs: []uuid.UUID{tagged.UUID, untagged.UUID, uuid.New()},
+	}
+
+	gotProjects, err := e.fetchProjects(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error fetching projects: %s", err)
+	}
+
+	if diff := cmp.Diff([]dtrack.Project{tagged}, gotProjects); diff != "" {
+		t.Errorf("unexpected projects:\n%s", diff)
+	}
+}
+
 func TestFetchPolicyViolations_Pagination(t *testing.T) {
 	mux := http.NewServeMux()
 	server := httptest.NewServer(mux)
@@ -174,7 +387,7 @@ func TestFetchPolicyViolations_Pagination(t *testing.T) {
 	}
 }
 
-func TestExporter_Run(t *testing.T) {
+func TestFetchFindings_Pagination(t *testing.T) {
 	mux := http.NewServeMux()
 	server := httptest.NewServer(mux)
 	defer server.Close()
@@ -185,49 +398,1871 @@ func TestExporter_Run(t *testing.T) {
 		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
 	})
 
-	// Mock Portfolio metrics
-	mux.HandleFunc("/api/v1/metrics/portfolio/latest", func(w http.ResponseWriter, r *http.Request) {
+	project := dtrack.Project{UUID: uuid.New()}
+
+	var wantFindings []dtrack.Finding
+	for i := 0; i < 468; i++ {
+		wantFindings = append(wantFindings, dtrack.Finding{
+			Vulnerability: dtrack.FindingVulnerability{
+				UUID: uuid.New(),
+			},
+		})
+	}
+
+	mux.HandleFunc("/api/v1/finding/project/"+project.UUID.String(), func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("suppressed"); got != "false" {
+			t.Errorf("unexpected suppressed query parameter: %q", got)
+		}
+		pageSize, err := strconv.Atoi(r.URL.Query().Get("pageSize"))
+		if err != nil {
+			t.Fatalf("unexpected error converting pageSize to int: %s", err)
+		}
+		pageNumber, err := strconv.Atoi(r.URL.Query().Get("pageNumber"))
+		if err != nil {
+			t.Fatalf("unexpected error converting pageNumber to int: %s", err)
+		}
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(wantFindings)))
+		w.Header().Set("Content-type", "application/json")
+		var findings []dtrack.Finding
+		for i := 0; i < pageSize; i++ {
+			idx := (pageSize * (pageNumber - 1)) + i
+			if idx >= len(wantFindings) {
+				break
+			}
+			findings = append(findings, wantFindings[idx])
+		}
+		json.NewEncoder(w).Encode(findings)
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+
+	e := &Exporter{
+		Client: client,
+	}
+
+	gotFindings, err := e.fetchFindings(context.Background(), project)
+	if err != nil {
+		t.Fatalf("unexpected error fetching findings: %s", err)
+	}
+
+	if diff := cmp.Diff(wantFindings, gotFindings); diff != "" {
+		t.Errorf("unexpected findings:\n%s", diff)
+	}
+}
+
+func TestForEachCachedFinding_Shards(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(dtrack.PortfolioMetrics{})
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
 	})
 
-	// Mock Projects
-	mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("X-Total-Count", "0")
+	var projects []dtrack.Project
+	for i := 0; i < 10; i++ {
+		projects = append(projects, dtrack.Project{UUID: uuid.New()})
+	}
+
+	requests := make(map[uuid.UUID]int)
+	for _, p := range projects {
+		mux.HandleFunc("/api/v1/finding/project/"+p.UUID.String(), func(w http.ResponseWriter, r *http.Request) {
+			requests[p.UUID]++
+			w.Header().Set("X-Total-Count", "1")
+			w.Header().Set("Content-type", "application/json")
+			json.NewEncoder(w).Encode([]dtrack.Finding{{Vulnerability: dtrack.FindingVulnerability{VulnID: p.UUID.String()}}})
+		})
+	}
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+	e := &Exporter{
+		Client:        client,
+		RefreshShards: 2,
+	}
+
+	for poll := 0; poll < 3; poll++ {
+		cache := make(map[uuid.UUID][]*cachedFinding)
+		for _, p := range projects {
+			var got []string
+			err := e.forEachCachedFinding(context.Background(), p, cache, func(f *cachedFinding) error {
+				got = append(got, f.Vulnerability.VulnID)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("unexpected error fetching findings: %s", err)
+			}
+			if diff := cmp.Diff([]string{p.UUID.String()}, got); diff != "" {
+				t.Errorf("poll %d: unexpected findings:\n%s", poll, diff)
+			}
+		}
+		e.findingsCache = cache
+		e.refreshShard = (e.refreshShard + 1) % e.RefreshShards
+	}
+
+	// The first poll fetches every project, then shard 1 is refreshed on the
+	// second poll and shard 0 on the third
+	for _, p := range projects {
+		if got, want := requests[p.UUID], 2; got != want {
+			t.Errorf("unexpected number of requests for project in shard %d: got %d, want %d", projectShard(p.UUID, 2), got, want)
+		}
+	}
+}
+
+func TestExporter_PollRefreshShardsIncompletePass(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode([]dtrack.Project{})
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
 	})
 
-	// Mock Violations
-	mux.HandleFunc("/api/v1/violation", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("X-Total-Count", "0")
+	projects := []dtrack.Project{{UUID: uuid.New()}, {UUID: uuid.New()}}
+	mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(projects)))
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode([]dtrack.PolicyViolation{})
+		json.NewEncoder(w).Encode(projects)
 	})
+	for _, p := range projects {
+		mux.HandleFunc("/api/v1/finding/project/"+p.UUID.String(), func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Total-Count", "0")
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode([]dtrack.Finding{})
+		})
+	}
 
-	client, _ := dtrack.NewClient(server.URL)
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
 	e := &Exporter{
-		Client: client,
-		Logger: slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError})),
+		Client:          client,
+		Logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Collectors:      []string{"project"},
+		CollectFindings: true,
+		RefreshShards:   2,
+		// The pass stops at the project limit, before the second project
+		MaxProjects: 1,
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	// Start exporter in background with short interval
-	go e.Run(ctx, 100*time.Millisecond)
+	if err := e.poll(context.Background()); err != nil {
+		t.Fatalf("unexpected error polling: %s", err)
+	}
+	if e.findingsCache != nil || e.refreshShard != 0 {
+		t.Errorf("unexpected cache of an incomplete pass: %d projects cached, next shard %d", len(e.findingsCache), e.refreshShard)
+	}
 
-	// Wait for at least one poll to complete
-	deadline := time.Now().Add(2 * time.Second)
-	for time.Now().Before(deadline) {
-		e.mutex.RLock()
-		reg := e.registry
-		e.mutex.RUnlock()
-		if reg != nil {
-			return
-		}
-		time.Sleep(100 * time.Millisecond)
+	e.MaxProjects = 0
+	if err := e.poll(context.Background()); err != nil {
+		t.Fatalf("unexpected error polling: %s", err)
 	}
+	if len(e.findingsCache) != len(projects) || e.refreshShard != 1 {
+		t.Errorf("unexpected cache of a complete pass: %d projects cached, next shard %d", len(e.findingsCache), e.refreshShard)
+	}
+}
 
-	t.Fatal("Exporter failed to populate registry in time")
+func TestFetchProjects_PageSize(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	var gotPageSizes []string
+	mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+		gotPageSizes = append(gotPageSizes, r.URL.Query().Get("pageSize"))
+		w.Header().Set("X-Total-Count", "0")
+		w.Header().Set("Content-type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.Project{})
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+
+	e := &Exporter{
+		Client:   client,
+		PageSize: 500,
+	}
+
+	if _, err := e.fetchProjects(context.Background()); err != nil {
+		t.Fatalf("unexpected error fetching projects: %s", err)
+	}
+
+	if diff := cmp.Diff([]string{"500"}, gotPageSizes); diff != "" {
+		t.Errorf("unexpected page sizes:\n%s", diff)
+	}
+}
+
+func TestFetchProjects_RateLimited(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	wantProjects := []dtrack.Project{
+		{UUID: uuid.New()},
+	}
+
+	var requests int
+	mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(wantProjects)))
+		w.Header().Set("Content-type", "application/json")
+		json.NewEncoder(w).Encode(wantProjects)
+	})
+
+	client, err := dtrack.NewClient(server.URL, dtrack.WithHttpClient(&http.Client{
+		Transport: &RetryAfterTransport{},
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+
+	e := &Exporter{
+		Client: client,
+	}
+
+	start := time.Now()
+	gotProjects, err := e.fetchProjects(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error fetching projects: %s", err)
+	}
+
+	if diff := cmp.Diff(wantProjects, gotProjects); diff != "" {
+		t.Errorf("unexpected projects:\n%s", diff)
+	}
+	if requests != 2 {
+		t.Errorf("unexpected number of requests: got %d, want 2", requests)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expected the retry to wait for the Retry-After duration, took %s", elapsed)
+	}
+}
+
+func TestValidateProjectInfoLabels(t *testing.T) {
+	for _, tc := range []struct {
+		labels  []string
+		wantErr bool
+	}{
+		{labels: DefaultProjectInfoLabels},
+		{labels: []string{"uuid", "purl", "cpe", "swid_tag_id"}},
+		{labels: []string{"name", "version"}, wantErr: true},
+		{labels: []string{"uuid", "unknown"}, wantErr: true},
+		{labels: []string{"uuid", "name", "name"}, wantErr: true},
+	} {
+		err := ValidateProjectInfoLabels(tc.labels)
+		if gotErr := err != nil; gotErr != tc.wantErr {
+			t.Errorf("ValidateProjectInfoLabels(%v) returned err=%v, want error: %t", tc.labels, err, tc.wantErr)
+		}
+	}
+}
+
+func TestValidateTagLabels(t *testing.T) {
+	for _, tc := range []struct {
+		keys    []string
+		wantErr bool
+	}{
+		{keys: nil},
+		{keys: []string{"team", "env"}},
+		{keys: []string{"team-name"}, wantErr: true},
+		{keys: []string{"name"}, wantErr: true},
+		{keys: []string{"team", "team"}, wantErr: true},
+	} {
+		err := ValidateTagLabels(tc.keys)
+		if gotErr := err != nil; gotErr != tc.wantErr {
+			t.Errorf("ValidateTagLabels(%v) returned err=%v, want error: %t", tc.keys, err, tc.wantErr)
+		}
+	}
+}
+
+func TestValidateViolationStates(t *testing.T) {
+	for _, tc := range []struct {
+		states  []string
+		wantErr bool
+	}{
+		{states: nil},
+		{states: []string{"FAIL", "WARN"}},
+		{states: []string{"fail"}, wantErr: true},
+		{states: []string{"ERROR"}, wantErr: true},
+	} {
+		err := ValidateViolationStates(tc.states)
+		if gotErr := err != nil; gotErr != tc.wantErr {
+			t.Errorf("ValidateViolationStates(%v) returned err=%v, want error: %t", tc.states, err, tc.wantErr)
+		}
+	}
+}
+
+func TestValidateMetricNamespace(t *testing.T) {
+	for _, tc := range []struct {
+		namespace string
+		wantErr   bool
+	}{
+		{namespace: Namespace},
+		{namespace: "dtrack"},
+		{namespace: "", wantErr: true},
+		{namespace: "dependency-track", wantErr: true},
+		{namespace: "1dtrack", wantErr: true},
+	} {
+		err := ValidateMetricNamespace(tc.namespace)
+		if gotErr := err != nil; gotErr != tc.wantErr {
+			t.Errorf("ValidateMetricNamespace(%q) returned err=%v, want error: %t", tc.namespace, err, tc.wantErr)
+		}
+	}
+}
+
+func TestValidateFindingAgeBuckets(t *testing.T) {
+	for _, tc := range []struct {
+		buckets []time.Duration
+		wantErr bool
+	}{
+		{buckets: DefaultFindingAgeBuckets},
+		{buckets: []time.Duration{time.Hour}},
+		{buckets: []time.Duration{0}, wantErr: true},
+		{buckets: []time.Duration{time.Hour, time.Hour}, wantErr: true},
+		{buckets: []time.Duration{2 * time.Hour, time.Hour}, wantErr: true},
+	} {
+		err := ValidateFindingAgeBuckets(tc.buckets)
+		if gotErr := err != nil; gotErr != tc.wantErr {
+			t.Errorf("ValidateFindingAgeBuckets(%v) returned err=%v, want error: %t", tc.buckets, err, tc.wantErr)
+		}
+	}
+}
+
+func TestSeverityCounts(t *testing.T) {
+	want := map[string]int{
+		"CRITICAL":   1,
+		"HIGH":       2,
+		"MEDIUM":     3,
+		"LOW":        4,
+		"UNASSIGNED": 5,
+	}
+	portfolio := dtrack.PortfolioMetrics{Critical: 1, High: 2, Medium: 3, Low: 4, Unassigned: 5}
+	if diff := cmp.Diff(want, portfolioSeverityCounts(portfolio)); diff != "" {
+		t.Errorf("unexpected portfolio severity counts (-want +got):\n%s", diff)
+	}
+	project := dtrack.ProjectMetrics{Critical: 1, High: 2, Medium: 3, Low: 4, Unassigned: 5}
+	if diff := cmp.Diff(want, projectSeverityCounts(project)); diff != "" {
+		t.Errorf("unexpected project severity counts (-want +got):\n%s", diff)
+	}
+}
+
+func TestSummarizeList(t *testing.T) {
+	if got, want := summarizeList([]string{"prod", "staging"}), "prod,staging"; got != want {
+		t.Errorf("unexpected summary: got %q, want %q", got, want)
+	}
+
+	long := make([]string, 20)
+	for i := range long {
+		long[i] = "team-" + strconv.Itoa(i)
+	}
+	got := summarizeList(long)
+	if len(got) > maxConfigLabelLength || !strings.HasPrefix(got, "20 values, fnv32a:") {
+		t.Errorf("unexpected summary of a long list: %q", got)
+	}
+}
+
+func TestExporter_HandlerFunc_NotInitialized(t *testing.T) {
+	e := &Exporter{}
+	h := e.HandlerFunc()
+
+	for _, tc := range []struct {
+		accept          string
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			accept:          "text/plain",
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "Exporter not yet initialized\n",
+		},
+		{
+			accept:          "application/json",
+			wantContentType: "application/json",
+			wantBody:        `{"status":"initializing"}` + "\n",
+		},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Accept", tc.accept)
+		rec := httptest.NewRecorder()
+
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("Accept %q: unexpected status code: got %d, want %d", tc.accept, rec.Code, http.StatusServiceUnavailable)
+		}
+		if got := rec.Header().Get("Content-Type"); got != tc.wantContentType {
+			t.Errorf("Accept %q: unexpected content type: got %q, want %q", tc.accept, got, tc.wantContentType)
+		}
+		if got := rec.Body.String(); got != tc.wantBody {
+			t.Errorf("Accept %q: unexpected body: got %q, want %q", tc.accept, got, tc.wantBody)
+		}
+	}
+}
+
+func TestExporter_HandlerFunc_OpenMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "test_gauge",
+		Help: "A test gauge.",
+	}))
+	e := &Exporter{registry: registry}
+	h := e.HandlerFunc()
+
+	for _, tc := range []struct {
+		accept          string
+		wantContentType string
+	}{
+		{
+			accept:          "text/plain",
+			wantContentType: "text/plain",
+		},
+		{
+			accept:          "application/openmetrics-text;version=1.0.0",
+			wantContentType: "application/openmetrics-text",
+		},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Accept", tc.accept)
+		rec := httptest.NewRecorder()
+
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("Accept %q: unexpected status code: got %d, want %d", tc.accept, rec.Code, http.StatusOK)
+		}
+		if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, tc.wantContentType) {
+			t.Errorf("Accept %q: unexpected content type: got %q, want prefix %q", tc.accept, got, tc.wantContentType)
+		}
+	}
+}
+
+func TestExporter_HandlerFunc_Gzip(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "test_gauge",
+		Help: "A test gauge.",
+	}))
+	e := &Exporter{registry: registry}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	e.HandlerFunc().ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("unexpected content encoding: got %q, want %q", got, "gzip")
+	}
+	r, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("unexpected error reading gzipped response: %s", err)
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error decompressing response: %s", err)
+	}
+	if !strings.Contains(string(body), "test_gauge 0") {
+		t.Errorf("expected test_gauge in decompressed output, got:\n%s", body)
+	}
+}
+
+func TestExporter_HandlerFunc_Gatherers(t *testing.T) {
+	buildInfo := versioncollector.NewCollector("dependency_track_exporter")
+	prometheus.MustRegister(buildInfo)
+	defer prometheus.Unregister(buildInfo)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "test_gauge",
+		Help: "A test gauge.",
+	}))
+	e := &Exporter{registry: registry}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	e.HandlerFunc().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: got %d, want %d", rec.Code, http.StatusOK)
+	}
+	for _, name := range []string{"dependency_track_exporter_build_info", "test_gauge"} {
+		if !strings.Contains(rec.Body.String(), name) {
+			t.Errorf("expected %s in output", name)
+		}
+	}
+}
+
+func TestExporter_HandlerFunc_MaxDataAge(t *testing.T) {
+	now := time.Now()
+	for _, tc := range []struct {
+		name              string
+		lastPoll          time.Time
+		lastPortfolioPoll time.Time
+		perCollectorPolls bool
+		wantCode          int
+	}{
+		{
+			name:     "fresh",
+			lastPoll: now.Add(-time.Minute),
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "stale",
+			lastPoll: now.Add(-time.Hour),
+			wantCode: http.StatusServiceUnavailable,
+		},
+		{
+			// The portfolio was polled last, but the projects are stale
+			name:              "stale projects",
+			lastPoll:          now.Add(-time.Hour),
+			lastPortfolioPoll: now.Add(-time.Minute),
+			perCollectorPolls: true,
+			wantCode:          http.StatusServiceUnavailable,
+		},
+		{
+			// The projects were polled last, but the portfolio is stale
+			name:              "stale portfolio",
+			lastPoll:          now.Add(-time.Minute),
+			lastPortfolioPoll: now.Add(-time.Hour),
+			perCollectorPolls: true,
+			wantCode:          http.StatusServiceUnavailable,
+		},
+		{
+			name:              "fresh portfolio and projects",
+			lastPoll:          now.Add(-time.Minute),
+			lastPortfolioPoll: now.Add(-2 * time.Minute),
+			perCollectorPolls: true,
+			wantCode:          http.StatusOK,
+		},
+	} {
+		e := &Exporter{
+			MaxDataAge:         10 * time.Minute,
+			registry:           prometheus.NewRegistry(),
+			lastSuccessfulPoll: tc.lastPoll,
+		}
+		if tc.perCollectorPolls {
+			e.portfolioRegistry = prometheus.NewRegistry()
+			e.lastSuccessfulPortfolioPoll = tc.lastPortfolioPoll
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		e.HandlerFunc().ServeHTTP(rec, req)
+
+		if rec.Code != tc.wantCode {
+			t.Errorf("%s: unexpected status code: got %d, want %d", tc.name, rec.Code, tc.wantCode)
+		}
+		if tc.wantCode == http.StatusServiceUnavailable {
+			if got, want := rec.Body.String(), `{"status":"stale"}`+"\n"; got != want {
+				t.Errorf("%s: unexpected body: got %q, want %q", tc.name, got, want)
+			}
+		}
+	}
+}
+
+func TestExporter_Run(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	// Mock Portfolio metrics
+	mux.HandleFunc("/api/v1/metrics/portfolio/latest", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dtrack.PortfolioMetrics{})
+	})
+
+	// Mock Projects
+	mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", "0")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.Project{})
+	})
+
+	// Mock Violations
+	mux.HandleFunc("/api/v1/violation", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", "0")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.PolicyViolation{})
+	})
+
+	client, _ := dtrack.NewClient(server.URL)
+	e := &Exporter{
+		Client: client,
+		Logger: slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError})),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Start exporter in background with short interval
+	go e.Run(ctx, 100*time.Millisecond)
+
+	// Wait for at least one poll to complete
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		e.mutex.RLock()
+		reg := e.registry
+		e.mutex.RUnlock()
+		if reg != nil {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	t.Fatal("Exporter failed to populate registry in time")
+}
+
+func TestExporter_Run_Cancel(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	// Mock a portfolio endpoint that hangs until the request is aborted
+	requested := make(chan struct{})
+	var once sync.Once
+	mux.HandleFunc("/api/v1/metrics/portfolio/current", func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() { close(requested) })
+		<-r.Context().Done()
+	})
+
+	client, _ := dtrack.NewClient(server.URL)
+	e := &Exporter{
+		Client:     client,
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Collectors: []string{"portfolio"},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Run(ctx, time.Hour)
+	}()
+
+	select {
+	case <-requested:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Exporter didn't poll in time")
+	}
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run didn't return after the context was cancelled")
+	}
+
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	if e.registry != nil {
+		t.Error("expected the metrics of the cancelled poll to be discarded")
+	}
+}
+
+func TestExporter_Run_StartupRetry(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	// Mock a server that is unavailable for the first request
+	var requests atomic.Int32
+	mux.HandleFunc("/api/v1/metrics/portfolio/current", func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dtrack.PortfolioMetrics{})
+	})
+
+	client, _ := dtrack.NewClient(server.URL)
+	e := &Exporter{
+		Client:         client,
+		Logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Collectors:     []string{"portfolio"},
+		StartupTimeout: time.Minute,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The interval is long enough that only a retry can succeed in time
+	go e.Run(ctx, time.Hour)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		e.mutex.RLock()
+		lastSuccessfulPoll := e.lastSuccessfulPoll
+		e.mutex.RUnlock()
+		if !lastSuccessfulPoll.IsZero() {
+			if got := requests.Load(); got != 2 {
+				t.Errorf("unexpected number of requests: got %d, want 2", got)
+			}
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	t.Fatal("Exporter didn't retry the initial poll in time")
+}
+
+func TestExporter_Run_StartupUnreachable(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock a server that is unavailable when the exporter starts, so that the
+	// client can't fetch its version
+	var versionRequests atomic.Int32
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		if versionRequests.Add(1) == 1 {
+			http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	mux.HandleFunc("/api/v1/metrics/portfolio/current", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dtrack.PortfolioMetrics{})
+	})
+
+	e := &Exporter{
+		NewClient: func() (*dtrack.Client, error) {
+			return dtrack.NewClient(server.URL)
+		},
+		Logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Collectors:     []string{"portfolio"},
+		StartupTimeout: time.Minute,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The interval is long enough that only a retry can succeed in time
+	go e.Run(ctx, time.Hour)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		e.mutex.RLock()
+		lastSuccessfulPoll := e.lastSuccessfulPoll
+		e.mutex.RUnlock()
+		if !lastSuccessfulPoll.IsZero() {
+			if got := versionRequests.Load(); got != 2 {
+				t.Errorf("unexpected number of version requests: got %d, want 2", got)
+			}
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	t.Fatal("Exporter didn't create the client on a retry of the initial poll in time")
+}
+
+func TestExporter_Run_PerCollectorIntervals(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	var portfolioRequests, projectRequests atomic.Int32
+	mux.HandleFunc("/api/v1/metrics/portfolio/current", func(w http.ResponseWriter, r *http.Request) {
+		portfolioRequests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dtrack.PortfolioMetrics{})
+	})
+	mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+		projectRequests.Add(1)
+		w.Header().Set("X-Total-Count", "0")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.Project{})
+	})
+
+	client, _ := dtrack.NewClient(server.URL)
+	e := &Exporter{
+		Client:                client,
+		Logger:                slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Collectors:            []string{"portfolio", "project"},
+		PortfolioPollInterval: 50 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx, time.Hour)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && portfolioRequests.Load() < 3 {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if got := portfolioRequests.Load(); got < 3 {
+		t.Fatalf("expected the portfolio to be polled on its own interval, got %d requests", got)
+	}
+	if got := projectRequests.Load(); got != 1 {
+		t.Errorf("unexpected number of project requests: got %d, want 1", got)
+	}
+
+	// Both collectors are served
+	rec := httptest.NewRecorder()
+	e.HandlerFunc().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, name := range []string{"dependency_track_portfolio_inherited_risk_score", "dependency_track_exporter_project_limit_exceeded"} {
+		if !strings.Contains(rec.Body.String(), name) {
+			t.Errorf("expected %s in the response", name)
+		}
+	}
+
+	// The last successful poll is reported per scope
+	for _, scope := range []string{"portfolio", "projects"} {
+		series := `dependency_track_exporter_last_successful_poll_timestamp_seconds{scope="` + scope + `"}`
+		if !strings.Contains(rec.Body.String(), series) {
+			t.Errorf("expected %s in the response", series)
+		}
+	}
+}
+
+func TestExporter_PollRiskScoreDelta(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	// Mock portfolio metrics whose risk score rises by 5 on every poll
+	var score float64
+	mux.HandleFunc("/api/v1/metrics/portfolio/current", func(w http.ResponseWriter, r *http.Request) {
+		score += 5
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dtrack.PortfolioMetrics{InheritedRiskScore: score})
+	})
+
+	client, _ := dtrack.NewClient(server.URL)
+	e := &Exporter{
+		Client:     client,
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Collectors: []string{"portfolio"},
+	}
+
+	delta := func() (float64, bool) {
+		mfs, err := e.registry.Gather()
+		if err != nil {
+			t.Fatalf("unexpected error gathering metrics: %s", err)
+		}
+		for _, mf := range mfs {
+			if mf.GetName() == "dependency_track_portfolio_inherited_risk_score_delta" {
+				return mf.GetMetric()[0].GetGauge().GetValue(), true
+			}
+		}
+		return 0, false
+	}
+
+	if err := e.poll(context.Background()); err != nil {
+		t.Fatalf("unexpected error polling: %s", err)
+	}
+	if _, ok := delta(); ok {
+		t.Error("expected no delta after the first poll")
+	}
+
+	if err := e.poll(context.Background()); err != nil {
+		t.Fatalf("unexpected error polling: %s", err)
+	}
+	if got, ok := delta(); !ok || got != 5 {
+		t.Errorf("unexpected delta after the second poll: got %v (present: %t), want 5", got, ok)
+	}
+}
+
+func TestExporter_PollWithoutPortfolioMetrics(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	// Portfolio metrics endpoint intentionally not mocked, so it returns 404
+
+	mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", "1")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.Project{{UUID: uuid.New(), Name: "project"}})
+	})
+
+	mux.HandleFunc("/api/v1/violation", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", "0")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.PolicyViolation{})
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+	e := &Exporter{
+		Client: client,
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	e.poll(context.Background())
+
+	if !e.portfolioMetricsUnavailable {
+		t.Errorf("expected portfolio metrics to be marked as unavailable")
+	}
+
+	mfs, err := e.registry.Gather()
+	if err != nil {
+		t.Fatalf("unexpected error gathering metrics: %s", err)
+	}
+	var found bool
+	for _, mf := range mfs {
+		if mf.GetName() == "dependency_track_project_info" {
+			found = len(mf.GetMetric()) == 1
+		}
+	}
+	if !found {
+		t.Errorf("expected project metrics to be collected when portfolio metrics are unavailable")
+	}
+}
+
+func TestExporter_PollWithProjectError(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	good := dtrack.Project{UUID: uuid.New(), Name: "good"}
+	bad := dtrack.Project{UUID: uuid.New(), Name: "bad"}
+
+	mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", "2")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.Project{bad, good})
+	})
+
+	mux.HandleFunc("/api/v1/finding/project/"+good.UUID.String(), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", "0")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.Finding{})
+	})
+
+	// Collecting the findings of the bad project fails
+	mux.HandleFunc("/api/v1/finding/project/"+bad.UUID.String(), func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	mux.HandleFunc("/api/v1/violation", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", "0")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.PolicyViolation{})
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+	e := &Exporter{
+		Client:          client,
+		Logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Collectors:      []string{"project", "violation"},
+		CollectFindings: true,
+	}
+
+	var buf bytes.Buffer
+	if err := e.DryRun(context.Background(), &buf); err != nil {
+		t.Fatalf("unexpected error polling: %s", err)
+	}
+
+	for _, want := range []string{
+		"dependency_track_exporter_project_collection_errors 1\n",
+		`dependency_track_project_max_cvss{name="good",uuid="` + good.UUID.String() + `",version=""} 0` + "\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestExporter_PollPaginationMismatch(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	prod := dtrack.Project{UUID: uuid.New(), Name: "prod", Tags: []dtrack.Tag{{Name: "prod"}}}
+	shared := dtrack.Project{UUID: uuid.New(), Name: "shared", Tags: []dtrack.Tag{{Name: "prod"}, {Name: "staging"}}}
+	staging := dtrack.Project{UUID: uuid.New(), Name: "staging", Tags: []dtrack.Tag{{Name: "staging"}}}
+
+	// The portfolio reports one more project than it returns, as happens
+	// while BOMs are imported
+	mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", "4")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.Project{prod, shared, staging})
+	})
+	mux.HandleFunc("/api/v1/project/tag/prod", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", "2")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.Project{prod, shared})
+	})
+	mux.HandleFunc("/api/v1/project/tag/staging", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", "2")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.Project{shared, staging})
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		tags []string
+		want string
+	}{
+		{
+			name: "total differs from the items returned",
+			want: "dependency_track_exporter_pagination_mismatch 1\n",
+		},
+		{
+			// The totals of every tag are summed, and a project with several
+			// of the tags is returned, and counted, once for each
+			name: "totals of several tags agree",
+			tags: []string{"prod", "staging"},
+			want: "dependency_track_exporter_pagination_mismatch 0\n",
+		},
+	} {
+		e := &Exporter{
+			Client:      client,
+			Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+			Collectors:  []string{"project"},
+			ProjectTags: tc.tags,
+		}
+
+		var buf bytes.Buffer
+		if err := e.DryRun(context.Background(), &buf); err != nil {
+			t.Fatalf("%s: unexpected error polling: %s", tc.name, err)
+		}
+		if !strings.Contains(buf.String(), tc.want) {
+			t.Errorf("%s: expected output to contain %q, got:\n%s", tc.name, tc.want, buf.String())
+		}
+	}
+}
+
+func TestExporter_PollTagVulnerabilities(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	lastOccurrence := int(time.Now().UnixMilli())
+	collectionLogic := dtrack.CollectionLogicAggregateDirectChildren
+	projects := []dtrack.Project{
+		{
+			UUID:    uuid.New(),
+			Name:    "payments",
+			Tags:    []dtrack.Tag{{Name: "prod"}, {Name: "team-payments"}},
+			Metrics: dtrack.ProjectMetrics{Critical: 2, LastOccurrence: lastOccurrence},
+		},
+		{
+			UUID:    uuid.New(),
+			Name:    "billing",
+			Tags:    []dtrack.Tag{{Name: "prod"}},
+			Metrics: dtrack.ProjectMetrics{Critical: 1, High: 3, LastOccurrence: lastOccurrence},
+		},
+		// The metrics of a collection project are those of its children, so
+		// they aren't counted again
+		{
+			UUID:            uuid.New(),
+			Name:            "umbrella",
+			Tags:            []dtrack.Tag{{Name: "prod"}},
+			CollectionLogic: &collectionLogic,
+			Metrics:         dtrack.ProjectMetrics{Critical: 3, High: 3, LastOccurrence: lastOccurrence},
+		},
+	}
+	mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(projects)))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(projects)
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+	e := &Exporter{
+		Client:        client,
+		Logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Collectors:    []string{"project"},
+		AggregateTags: []string{"prod"},
+	}
+
+	var buf bytes.Buffer
+	if err := e.DryRun(context.Background(), &buf); err != nil {
+		t.Fatalf("unexpected error polling: %s", err)
+	}
+
+	for _, want := range []string{
+		`dependency_track_tag_vulnerabilities{severity="CRITICAL",tag="prod"} 3` + "\n",
+		`dependency_track_tag_vulnerabilities{severity="HIGH",tag="prod"} 3` + "\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+	// Only the tags of the allowlist are aggregated
+	if unwanted := `tag="team-payments"`; strings.Contains(buf.String(), unwanted) {
+		t.Errorf("unexpected %s in output:\n%s", unwanted, buf.String())
+	}
+}
+
+func TestExporter_PollDistinctVulnerabilities(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	lastOccurrence := int(time.Now().UnixMilli())
+	projects := []dtrack.Project{
+		{UUID: uuid.New(), Name: "payments", Metrics: dtrack.ProjectMetrics{LastOccurrence: lastOccurrence}},
+		{UUID: uuid.New(), Name: "billing", Metrics: dtrack.ProjectMetrics{LastOccurrence: lastOccurrence}},
+	}
+	mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(projects)))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(projects)
+	})
+
+	// Both projects are affected by the same critical vulnerability, and
+	// each by a high one of its own
+	shared := dtrack.FindingVulnerability{UUID: uuid.New(), VulnID: "CVE-2024-0001", Severity: "CRITICAL"}
+	for _, p := range projects {
+		findings := []dtrack.Finding{
+			{Vulnerability: shared},
+			{Vulnerability: dtrack.FindingVulnerability{UUID: uuid.New(), VulnID: "CVE-" + p.Name, Severity: "HIGH"}},
+		}
+		mux.HandleFunc("/api/v1/finding/project/"+p.UUID.String(), func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Total-Count", strconv.Itoa(len(findings)))
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(findings)
+		})
+	}
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+	e := &Exporter{
+		Client:          client,
+		Logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Collectors:      []string{"project"},
+		CollectFindings: true,
+	}
+
+	var buf bytes.Buffer
+	if err := e.DryRun(context.Background(), &buf); err != nil {
+		t.Fatalf("unexpected error polling: %s", err)
+	}
+
+	for _, want := range []string{
+		`dependency_track_portfolio_distinct_vulnerabilities{severity="CRITICAL"} 1` + "\n",
+		`dependency_track_portfolio_distinct_vulnerabilities{severity="HIGH"} 2` + "\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestExporter_PollUUIDOnlyLabels(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	project := dtrack.Project{
+		UUID:          uuid.New(),
+		Name:          "project",
+		Version:       "1.0.0",
+		LastBOMImport: int(time.Now().UnixMilli()),
+		Metrics:       dtrack.ProjectMetrics{LastOccurrence: int(time.Now().UnixMilli())},
+	}
+	mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", "1")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.Project{project})
+	})
+	mux.HandleFunc("/api/v1/violation", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", "1")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.PolicyViolation{{
+			UUID:    uuid.New(),
+			Project: project,
+			Type:    "SECURITY",
+			PolicyCondition: &dtrack.PolicyCondition{
+				Policy: &dtrack.Policy{ViolationState: dtrack.PolicyViolationStateFail},
+			},
+		}})
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+
+	for _, tc := range []struct {
+		uuidOnly bool
+		want     map[string][]string
+	}{
+		{
+			uuidOnly: false,
+			want: map[string][]string{
+				"dependency_track_project_vulnerabilities":      {"name", "severity", "uuid", "version"},
+				"dependency_track_project_policy_violations":    {"analysis", "name", "state", "suppressed", "type", "uuid", "version"},
+				"dependency_track_project_last_bom_import":      {"name", "uuid", "version"},
+				"dependency_track_project_inherited_risk_score": {"name", "uuid", "version"},
+			},
+		},
+		{
+			uuidOnly: true,
+			want: map[string][]string{
+				"dependency_track_project_vulnerabilities":      {"severity", "uuid"},
+				"dependency_track_project_policy_violations":    {"analysis", "state", "suppressed", "type", "uuid"},
+				"dependency_track_project_last_bom_import":      {"uuid"},
+				"dependency_track_project_inherited_risk_score": {"uuid"},
+			},
+		},
+	} {
+		e := &Exporter{
+			Client:         client,
+			Logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+			Collectors:     []string{"project", "violation"},
+			UUIDOnlyLabels: tc.uuidOnly,
+		}
+		if err := e.poll(context.Background()); err != nil {
+			t.Fatalf("unexpected error polling: %s", err)
+		}
+
+		mfs, err := e.registry.Gather()
+		if err != nil {
+			t.Fatalf("unexpected error gathering metrics: %s", err)
+		}
+		got := make(map[string][]string)
+		for _, mf := range mfs {
+			if _, ok := tc.want[mf.GetName()]; !ok {
+				continue
+			}
+			var names []string
+			for _, l := range mf.GetMetric()[0].GetLabel() {
+				names = append(names, l.GetName())
+			}
+			got[mf.GetName()] = names
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("uuid-only %t: unexpected label names (-want +got):\n%s", tc.uuidOnly, diff)
+		}
+	}
+}
+
+func TestExporter_PollLastSuccessfulPoll(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	// Mock Portfolio metrics, which fail once failPortfolio is set
+	var failPortfolio atomic.Bool
+	mux.HandleFunc("/api/v1/metrics/portfolio/current", func(w http.ResponseWriter, r *http.Request) {
+		if failPortfolio.Load() {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dtrack.PortfolioMetrics{})
+	})
+
+	mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", "0")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.Project{})
+	})
+
+	mux.HandleFunc("/api/v1/violation", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", "0")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.PolicyViolation{})
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+	e := &Exporter{
+		Client: client,
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	lastSuccessfulPoll := func() float64 {
+		mfs, err := e.registry.Gather()
+		if err != nil {
+			t.Fatalf("unexpected error gathering metrics: %s", err)
+		}
+		for _, mf := range mfs {
+			if mf.GetName() == "dependency_track_exporter_last_successful_poll_timestamp_seconds" {
+				return mf.GetMetric()[0].GetGauge().GetValue()
+			}
+		}
+		t.Fatal("expected dependency_track_exporter_last_successful_poll_timestamp_seconds to be exported")
+		return 0
+	}
+
+	before := float64(time.Now().UnixNano()) / 1e9
+	if err := e.poll(context.Background()); err != nil {
+		t.Fatalf("unexpected error polling: %s", err)
+	}
+	succeeded := lastSuccessfulPoll()
+	if succeeded < before {
+		t.Errorf("unexpected last successful poll: got %v, want at least %v", succeeded, before)
+	}
+
+	// A failed poll keeps the time of the last successful one
+	failPortfolio.Store(true)
+	if err := e.poll(context.Background()); err == nil {
+		t.Fatal("expected an error polling")
+	}
+	if got := lastSuccessfulPoll(); got != succeeded {
+		t.Errorf("unexpected last successful poll after a failed poll: got %v, want %v", got, succeeded)
+	}
+}
+
+func TestExporter_DryRun(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	mux.HandleFunc("/api/v1/metrics/portfolio/current", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dtrack.PortfolioMetrics{InheritedRiskScore: 42})
+	})
+
+	mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", "0")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.Project{})
+	})
+
+	mux.HandleFunc("/api/v1/violation", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", "0")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.PolicyViolation{})
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+	e := &Exporter{
+		Client: client,
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	var buf bytes.Buffer
+	if err := e.DryRun(context.Background(), &buf); err != nil {
+		t.Fatalf("unexpected error during dry run: %s", err)
+	}
+
+	if want := "dependency_track_portfolio_inherited_risk_score 42\n"; !strings.Contains(buf.String(), want) {
+		t.Errorf("expected output to contain %q, got:\n%s", want, buf.String())
+	}
+}
+
+func TestExporter_PollNewPolicyViolations(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	project := dtrack.Project{UUID: uuid.New(), Name: "project"}
+	violation := func() dtrack.PolicyViolation {
+		return dtrack.PolicyViolation{
+			UUID:    uuid.New(),
+			Project: project,
+			Type:    "SECURITY",
+			PolicyCondition: &dtrack.PolicyCondition{
+				Policy: &dtrack.Policy{ViolationState: dtrack.PolicyViolationStateFail},
+			},
+		}
+	}
+
+	var (
+		mutex      sync.Mutex
+		projects   = []dtrack.Project{project}
+		violations = []dtrack.PolicyViolation{violation()}
+		// Whether the second page of violations fails
+		failSecondPage bool
+	)
+	mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(projects)))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(projects)
+	})
+	mux.HandleFunc("/api/v1/violation", func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		pageNumber, _ := strconv.Atoi(r.URL.Query().Get("pageNumber"))
+		if pageNumber == 2 && failSecondPage {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(violations)))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(violations[min(pageNumber-1, len(violations)):min(pageNumber, len(violations))])
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+	e := &Exporter{
+		Client:     client,
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Collectors: []string{"violation"},
+		PageSize:   1,
+	}
+
+	newViolations := func() (float64, bool) {
+		mfs, err := e.registry.Gather()
+		if err != nil {
+			t.Fatalf("unexpected error gathering metrics: %s", err)
+		}
+		for _, mf := range mfs {
+			if mf.GetName() == "dependency_track_project_new_policy_violations" {
+				return mf.GetMetric()[0].GetCounter().GetValue(), true
+			}
+		}
+		return 0, false
+	}
+
+	// The violations of the first poll aren't new
+	if err := e.poll(context.Background()); err != nil {
+		t.Fatalf("unexpected error polling: %s", err)
+	}
+
+	// A new violation seen by a poll that fails partway isn't counted
+	mutex.Lock()
+	violations = []dtrack.PolicyViolation{violation(), violations[0]}
+	failSecondPage = true
+	mutex.Unlock()
+	if err := e.poll(context.Background()); err == nil {
+		t.Fatal("expected an error polling")
+	}
+	if got, ok := newViolations(); ok {
+		t.Errorf("unexpected new violations after a failed poll: %v", got)
+	}
+
+	// It's counted once by the next successful poll
+	mutex.Lock()
+	failSecondPage = false
+	mutex.Unlock()
+	for range 2 {
+		if err := e.poll(context.Background()); err != nil {
+			t.Fatalf("unexpected error polling: %s", err)
+		}
+	}
+	if got, ok := newViolations(); !ok || got != 1 {
+		t.Errorf("unexpected new violations: got %v (present: %t), want 1", got, ok)
+	}
+
+	// The series is deleted once the project is removed
+	mutex.Lock()
+	projects = nil
+	violations = nil
+	mutex.Unlock()
+	if err := e.poll(context.Background()); err != nil {
+		t.Fatalf("unexpected error polling: %s", err)
+	}
+	if got, ok := newViolations(); ok {
+		t.Errorf("unexpected new violations for a removed project: %v", got)
+	}
+}
+
+func TestExporter_WriteOutputFile(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	mux.HandleFunc("/api/v1/metrics/portfolio/current", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dtrack.PortfolioMetrics{InheritedRiskScore: 42})
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+	dir := t.TempDir()
+	e := &Exporter{
+		Client:     client,
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Collectors: []string{"portfolio"},
+		OutputFile: filepath.Join(dir, "dependency_track.prom"),
+	}
+
+	if err := e.poll(context.Background()); err != nil {
+		t.Fatalf("unexpected error polling: %s", err)
+	}
+	if err := e.writeOutputFile(); err != nil {
+		t.Fatalf("unexpected error writing the output file: %s", err)
+	}
+
+	b, err := os.ReadFile(e.OutputFile)
+	if err != nil {
+		t.Fatalf("unexpected error reading the output file: %s", err)
+	}
+	if want := "dependency_track_portfolio_inherited_risk_score 42\n"; !strings.Contains(string(b), want) {
+		t.Errorf("expected output file to contain %q, got:\n%s", want, b)
+	}
+	if strings.Contains(string(b), "go_goroutines") {
+		t.Errorf("expected output file not to contain the Go metrics, got:\n%s", b)
+	}
+
+	// The temporary file is renamed, so it's the only file left
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error reading the output directory: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("unexpected files in the output directory: %v", entries)
+	}
+}
+
+func TestSuppressedOn(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	suppressedVulnerability := uuid.New()
+	suppressed := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	mux.HandleFunc("/api/v1/analysis", func(w http.ResponseWriter, r *http.Request) {
+		var comments []dtrack.AnalysisComment
+		// Only the suppressed vulnerability has a suppression in its trail
+		if r.URL.Query().Get("vulnerability") == suppressedVulnerability.String() {
+			comments = []dtrack.AnalysisComment{
+				{Comment: "Suppressed", Timestamp: int(suppressed.Add(-24 * time.Hour).UnixMilli())},
+				{Comment: "Unsuppressed", Timestamp: int(suppressed.Add(-time.Hour).UnixMilli())},
+				{Comment: "Suppressed", Timestamp: int(suppressed.UnixMilli())},
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dtrack.Analysis{Comments: comments, Suppressed: true})
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+	e := &Exporter{Client: client}
+	project := dtrack.Project{UUID: uuid.New()}
+
+	for _, tc := range []struct {
+		vulnerability uuid.UUID
+		want          time.Time
+	}{
+		{vulnerability: suppressedVulnerability, want: suppressed},
+		// Findings without a record of their suppression have no time
+		{vulnerability: uuid.New(), want: time.Time{}},
+	} {
+		f := dtrack.Finding{Vulnerability: dtrack.FindingVulnerability{UUID: tc.vulnerability}}
+		got, err := e.suppressedOn(context.Background(), project, f)
+		if err != nil {
+			t.Fatalf("unexpected error getting the suppression time: %s", err)
+		}
+		if !got.Equal(tc.want) {
+			t.Errorf("unexpected suppression time: got %s, want %s", got, tc.want)
+		}
+	}
+}
+
+func TestExporter_PollCachesSuppressionTimes(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	var projects []dtrack.Project
+	for i := 0; i < 10; i++ {
+		projects = append(projects, dtrack.Project{
+			UUID:    uuid.New(),
+			Metrics: dtrack.ProjectMetrics{LastOccurrence: int(time.Now().UnixMilli())},
+		})
+	}
+	mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(projects)))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(projects)
+	})
+
+	var (
+		mutex            sync.Mutex
+		findingRequests  = make(map[string]int)
+		analysisRequests = make(map[string]int)
+	)
+	for _, p := range projects {
+		mux.HandleFunc("/api/v1/finding/project/"+p.UUID.String(), func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			findingRequests[p.UUID.String()]++
+			mutex.Unlock()
+			w.Header().Set("X-Total-Count", "1")
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode([]dtrack.Finding{{
+				Vulnerability: dtrack.FindingVulnerability{UUID: uuid.New()},
+				Analysis:      dtrack.FindingAnalysis{Suppressed: true},
+			}})
+		})
+	}
+	mux.HandleFunc("/api/v1/analysis", func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		analysisRequests[r.URL.Query().Get("project")]++
+		mutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dtrack.Analysis{
+			Comments:   []dtrack.AnalysisComment{{Comment: "Suppressed", Timestamp: int(time.Now().UnixMilli())}},
+			Suppressed: true,
+		})
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+	e := &Exporter{
+		Client:                    client,
+		Logger:                    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Collectors:                []string{"project"},
+		CollectFindings:           true,
+		IncludeSuppressedFindings: true,
+		RecentSuppressionWindow:   time.Hour,
+		RefreshShards:             2,
+	}
+
+	for poll := 0; poll < 3; poll++ {
+		if err := e.poll(context.Background()); err != nil {
+			t.Fatalf("unexpected error polling: %s", err)
+		}
+
+		mfs, err := e.registry.Gather()
+		if err != nil {
+			t.Fatalf("unexpected error gathering metrics: %s", err)
+		}
+		var recent float64
+		for _, mf := range mfs {
+			if mf.GetName() != "dependency_track_project_findings_suppressed_recent" {
+				continue
+			}
+			for _, m := range mf.GetMetric() {
+				recent += m.GetGauge().GetValue()
+			}
+		}
+		// The findings served from the cache are still counted
+		if recent != float64(len(projects)) {
+			t.Errorf("poll %d: unexpected recently suppressed findings: got %v, want %d", poll, recent, len(projects))
+		}
+	}
+
+	// The suppression time is only looked up when the findings are fetched
+	mutex.Lock()
+	defer mutex.Unlock()
+	if diff := cmp.Diff(findingRequests, analysisRequests); diff != "" {
+		t.Errorf("unexpected analysis requests per project (-findings +analyses):\n%s", diff)
+	}
+}
+
+func TestExporter_PollWithMissingProjectMetrics(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	computed := dtrack.Project{
+		UUID:    uuid.New(),
+		Name:    "computed",
+		Metrics: dtrack.ProjectMetrics{LastOccurrence: int(time.Now().UnixMilli()), InheritedRiskScore: 5},
+	}
+	// Dependency-Track returns zeros for projects whose metrics were never
+	// computed
+	missing := dtrack.Project{UUID: uuid.New(), Name: "missing"}
+	mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", "2")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.Project{computed, missing})
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+	e := &Exporter{
+		Client:     client,
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Collectors: []string{"project"},
+	}
+	if err := e.poll(context.Background()); err != nil {
+		t.Fatalf("unexpected error polling: %s", err)
+	}
+
+	mfs, err := e.registry.Gather()
+	if err != nil {
+		t.Fatalf("unexpected error gathering metrics: %s", err)
+	}
+
+	// The projects reported by every metric, by name
+	got := make(map[string]map[string]float64)
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() != "name" {
+					continue
+				}
+				if got[mf.GetName()] == nil {
+					got[mf.GetName()] = make(map[string]float64)
+				}
+				got[mf.GetName()][l.GetValue()] = m.GetGauge().GetValue()
+			}
+		}
+	}
+
+	if diff := cmp.Diff(map[string]float64{"computed": 0, "missing": 1}, got["dependency_track_project_metrics_missing"]); diff != "" {
+		t.Errorf("unexpected dependency_track_project_metrics_missing (-want +got):\n%s", diff)
+	}
+	for _, name := range []string{
+		"dependency_track_project_inherited_risk_score",
+		"dependency_track_project_vulnerabilities",
+		"dependency_track_project_findings_total",
+	} {
+		if _, ok := got[name]["missing"]; ok {
+			t.Errorf("expected %s not to be reported for the project without metrics", name)
+		}
+		if _, ok := got[name]["computed"]; !ok {
+			t.Errorf("expected %s to be reported for the project with metrics", name)
+		}
+	}
 }
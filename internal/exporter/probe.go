@@ -0,0 +1,114 @@
+package exporter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	dtrack "github.com/DependencyTrack/client-go"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// ProbeHandlerFunc handles requests to /probe, which collect the metrics of the
+// single project given by the project parameter on demand, following the
+// multi-target exporter pattern. The project filters don't apply to probes.
+// Every probe makes API calls to Dependency-Track, so no more than
+// MaxRequestsInFlight run at once.
+func (e *Exporter) ProbeHandlerFunc() http.HandlerFunc {
+	var inFlight chan struct{}
+	if e.MaxRequestsInFlight > 0 {
+		inFlight = make(chan struct{}, e.MaxRequestsInFlight)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if inFlight != nil {
+			select {
+			case inFlight <- struct{}{}:
+				defer func() { <-inFlight }()
+			default:
+				http.Error(w, fmt.Sprintf("Limit of concurrent probes reached (%d), try again later.", e.MaxRequestsInFlight), http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		param := r.URL.Query().Get("project")
+		if param == "" {
+			http.Error(w, "project parameter is missing", http.StatusBadRequest)
+			return
+		}
+		id, err := uuid.Parse(param)
+		if err != nil {
+			http.Error(w, "project parameter is not a valid UUID", http.StatusBadRequest)
+			return
+		}
+
+		if err := e.connect(); err != nil {
+			e.Logger.Error("Error creating client", "err", err)
+			http.Error(w, "error connecting to Dependency-Track", http.StatusInternalServerError)
+			return
+		}
+
+		project, err := e.Client.Project.Get(r.Context(), id)
+		if err != nil {
+			var apiErr *dtrack.APIError
+			if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+				http.Error(w, "project not found", http.StatusNotFound)
+				return
+			}
+			e.Logger.Error("Error getting project", "uuid", id, "err", err)
+			http.Error(w, "error getting project", http.StatusInternalServerError)
+			return
+		}
+
+		registry := prometheus.NewRegistry()
+		if err := e.probeExporter(project).collectProjectMetrics(r.Context(), registry); err != nil {
+			e.Logger.Error("Error collecting project metrics", "uuid", id, "err", err)
+			http.Error(w, "error collecting project metrics", http.StatusInternalServerError)
+			return
+		}
+
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+			EnableOpenMetrics: true,
+		}).ServeHTTP(w, r)
+	}
+}
+
+// probeExporter returns an exporter that collects the metrics of project alone,
+// with the same collection options as e. The project filters and the options of
+// the background poll don't apply. It keeps no state between probes, so
+// findings are always fetched rather than refreshed by shard, and the outcome
+// of the collectors isn't recorded in CollectorStatus.
+func (e *Exporter) probeExporter(project dtrack.Project) *Exporter {
+	return &Exporter{
+		Client:                         e.Client,
+		Logger:                         e.Logger,
+		ProjectInfoLabels:              e.ProjectInfoLabels,
+		TagLabels:                      e.TagLabels,
+		AggregateTags:                  e.AggregateTags,
+		Collectors:                     e.Collectors,
+		InitializeViolationMetrics:     e.InitializeViolationMetrics,
+		CollectFindings:                e.CollectFindings,
+		CollectFindingsBySource:        e.CollectFindingsBySource,
+		CollectVulnerabilitiesDetailed: e.CollectVulnerabilitiesDetailed,
+		CollectAffectedProjects:        e.CollectAffectedProjects,
+		CollectComponents:              e.CollectComponents,
+		CollectLicenses:                e.CollectLicenses,
+		RefreshMetrics:                 e.RefreshMetrics,
+		AffectedProjectsLimit:          e.AffectedProjectsLimit,
+		IncludeSuppressedFindings:      e.IncludeSuppressedFindings,
+		RecentSuppressionWindow:        e.RecentSuppressionWindow,
+		CollectProjectTags:             e.CollectProjectTags,
+		IncludeParentLabels:            e.IncludeParentLabels,
+		IncludeIdentifiers:             e.IncludeIdentifiers,
+		FindingAgeBuckets:              e.FindingAgeBuckets,
+		ViolationStates:                e.ViolationStates,
+		UUIDOnlyLabels:                 e.UUIDOnlyLabels,
+		MetricsMaxAge:                  e.MetricsMaxAge,
+		StaleBOMThreshold:              e.StaleBOMThreshold,
+		PageSize:                       e.PageSize,
+		MetricNamespace:                e.MetricNamespace,
+		project:                        &project,
+	}
+}
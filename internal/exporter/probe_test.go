@@ -0,0 +1,208 @@
+package exporter
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	dtrack "github.com/DependencyTrack/client-go"
+	"github.com/google/uuid"
+)
+
+func TestExporter_ProbeHandlerFunc(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	projectUUID := uuid.New()
+	mux.HandleFunc("/api/v1/project/"+projectUUID.String(), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dtrack.Project{
+			UUID:    projectUUID,
+			Name:    "probed",
+			Version: "1.0.0",
+		})
+	})
+	mux.HandleFunc("/api/v1/project/", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	})
+
+	mux.HandleFunc("/api/v1/violation/project/"+projectUUID.String(), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", "0")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.PolicyViolation{})
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+
+	e := &Exporter{
+		Client: client,
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	h := e.ProbeHandlerFunc()
+
+	for _, tc := range []struct {
+		query    string
+		wantCode int
+		wantBody string
+	}{
+		{
+			query:    "",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			query:    "?project=not-a-uuid",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			query:    "?project=" + uuid.New().String(),
+			wantCode: http.StatusNotFound,
+		},
+		{
+			query:    "?project=" + projectUUID.String(),
+			wantCode: http.StatusOK,
+			wantBody: `dependency_track_project_info{active="false",classifier="",is_collection="false",name="probed",tags="",uuid="` + projectUUID.String() + `",version="1.0.0"} 1`,
+		},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/probe"+tc.query, nil)
+		rec := httptest.NewRecorder()
+
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != tc.wantCode {
+			t.Errorf("query %q: unexpected status code: got %d, want %d", tc.query, rec.Code, tc.wantCode)
+		}
+		if !strings.Contains(rec.Body.String(), tc.wantBody) {
+			t.Errorf("query %q: expected %s in output, got:\n%s", tc.query, tc.wantBody, rec.Body.String())
+		}
+	}
+}
+
+func TestExporter_ProbeHandlerFunc_MaxRequestsInFlight(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	// The first probe is held until the second one was made
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mux.HandleFunc("/api/v1/project/", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		http.Error(w, "not found", http.StatusNotFound)
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+
+	e := &Exporter{
+		Client:              client,
+		Logger:              slog.New(slog.NewTextHandler(io.Discard, nil)),
+		MaxRequestsInFlight: 1,
+	}
+	h := e.ProbeHandlerFunc()
+	query := "/probe?project=" + uuid.New().String()
+
+	done := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, query, nil))
+		done <- rec.Code
+	}()
+	<-started
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, query, nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("unexpected status code of a probe over the limit: got %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	close(release)
+	if code := <-done; code != http.StatusNotFound {
+		t.Errorf("unexpected status code of the first probe: got %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestExporter_ProbeExporter(t *testing.T) {
+	// The options that don't apply to probes
+	ignored := map[string]bool{
+		"ProjectTags":                true,
+		"ProjectClassifiers":         true,
+		"OnlyProjectsWithViolations": true,
+		"ProjectUUIDs":               true,
+		"CollectPolicies":            true,
+		"MaxProjects":                true,
+		"StartupTimeout":             true,
+		"MaxRequestsInFlight":        true,
+		"MaxDataAge":                 true,
+		"RefreshShards":              true,
+		"PushGateway":                true,
+		"PushJob":                    true,
+		"PushGrouping":               true,
+		"OutputFile":                 true,
+		"PollJitter":                 true,
+		"PortfolioPollInterval":      true,
+		"ProjectPollInterval":        true,
+		"RefreshMinInterval":         true,
+		"Debug":                      true,
+		"CollectorStatus":            true,
+		"Gatherer":                   true,
+	}
+
+	// Every option is set to a value other than its zero value
+	e := &Exporter{}
+	v := reflect.ValueOf(e).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if !v.Type().Field(i).IsExported() {
+			continue
+		}
+		switch f.Kind() {
+		case reflect.Bool:
+			f.SetBool(true)
+		case reflect.Int, reflect.Int64:
+			f.SetInt(1)
+		case reflect.String:
+			f.SetString("value")
+		case reflect.Slice:
+			f.Set(reflect.MakeSlice(f.Type(), 1, 1))
+		case reflect.Map:
+			f.Set(reflect.MakeMap(f.Type()))
+		case reflect.Pointer:
+			f.Set(reflect.New(f.Type().Elem()))
+		}
+	}
+
+	probe := reflect.ValueOf(e.probeExporter(dtrack.Project{})).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() || ignored[field.Name] {
+			continue
+		}
+		if !reflect.DeepEqual(v.Field(i).Interface(), probe.Field(i).Interface()) {
+			t.Errorf("option %s isn't copied to the probe exporter", field.Name)
+		}
+	}
+}
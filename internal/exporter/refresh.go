@@ -0,0 +1,64 @@
+package exporter
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// refreshResponse is the body of the responses of the refresh endpoint
+type refreshResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// RefreshHandlerFunc handles POST requests to /refresh, which poll
+// Dependency-Track immediately and respond once the poll has completed, with
+// its outcome. When the portfolio is polled on its own interval, it's refreshed
+// separately from the other collectors. Refreshes are rejected with a 429 until
+// RefreshMinInterval has elapsed since the previous one.
+func (e *Exporter) RefreshHandlerFunc() http.HandlerFunc {
+	var (
+		mutex       sync.Mutex
+		lastRefresh time.Time
+	)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		mutex.Lock()
+		if wait := e.RefreshMinInterval - time.Since(lastRefresh); !lastRefresh.IsZero() && wait > 0 {
+			mutex.Unlock()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "metrics were refreshed too recently", http.StatusTooManyRequests)
+			return
+		}
+		lastRefresh = time.Now()
+		mutex.Unlock()
+
+		e.Logger.Info("Refreshing metrics on request")
+		var errs []error
+		for _, scope := range e.scopes() {
+			errs = append(errs, e.update(r.Context(), scope))
+		}
+		resp := refreshResponse{Status: "success"}
+		code := http.StatusOK
+		if err := errors.Join(errs...); err != nil {
+			resp = refreshResponse{Status: "error", Error: err.Error()}
+			code = http.StatusInternalServerError
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			e.Logger.Error("Error encoding refresh response", "err", err)
+		}
+	}
+}
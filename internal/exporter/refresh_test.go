@@ -0,0 +1,149 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dtrack "github.com/DependencyTrack/client-go"
+)
+
+func TestExporter_RefreshHandlerFunc(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	mux.HandleFunc("/api/v1/metrics/portfolio/current", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dtrack.PortfolioMetrics{})
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+
+	e := &Exporter{
+		Client:             client,
+		Logger:             slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Collectors:         []string{"portfolio"},
+		RefreshMinInterval: time.Hour,
+	}
+	h := e.RefreshHandlerFunc()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/refresh", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("unexpected status code for a GET request: got %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/refresh", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: got %d, want %d", rec.Code, http.StatusOK)
+	}
+	var got refreshResponse
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("unexpected error decoding response: %s", err)
+	}
+	if got.Status != "success" {
+		t.Errorf("unexpected status: %+v", got)
+	}
+
+	// The refresh replaced the metrics, so the exporter is ready
+	e.mutex.RLock()
+	registry := e.registry
+	e.mutex.RUnlock()
+	if registry == nil {
+		t.Error("expected the refresh to store the metrics of its poll")
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/refresh", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("unexpected status code for a repeated refresh: got %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("expected a Retry-After header")
+	}
+}
+
+func TestExporter_RefreshHandlerFunc_PerCollectorIntervals(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Mock version endpoint
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+	})
+
+	var portfolioRequests atomic.Int32
+	mux.HandleFunc("/api/v1/metrics/portfolio/current", func(w http.ResponseWriter, r *http.Request) {
+		portfolioRequests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dtrack.PortfolioMetrics{})
+	})
+	mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", "0")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]dtrack.Project{})
+	})
+
+	client, err := dtrack.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error setting up client: %s", err)
+	}
+	e := &Exporter{
+		Client:                client,
+		Logger:                slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Collectors:            []string{"portfolio", "project"},
+		PortfolioPollInterval: time.Hour,
+		ProjectPollInterval:   2 * time.Hour,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx, time.Hour)
+
+	// Wait for the initial poll of both scopes
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		e.mutex.RLock()
+		ready := e.registry != nil && e.portfolioRegistry != nil
+		e.mutex.RUnlock()
+		if ready {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	e.RefreshHandlerFunc().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/refresh", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: got %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got := portfolioRequests.Load(); got != 2 {
+		t.Errorf("unexpected number of portfolio requests: got %d, want 2", got)
+	}
+
+	// The portfolio metrics are only served once
+	rec = httptest.NewRecorder()
+	e.HandlerFunc().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("unexpected status code for /metrics after a refresh: got %d, want %d\n%s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+}
@@ -0,0 +1,72 @@
+package exporter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CollectorStatus records whether the last run of every collector succeeded
+// and how long it took. It's a prometheus.Collector that exports them, meant to
+// be registered with a registry that outlives polls, so that the status of a
+// failed poll is still exposed.
+type CollectorStatus struct {
+	// MetricNamespace overrides the namespace of the exported metrics, which
+	// defaults to Namespace
+	MetricNamespace string
+
+	once     sync.Once
+	success  *prometheus.GaugeVec
+	duration *prometheus.GaugeVec
+}
+
+func (s *CollectorStatus) init() {
+	s.once.Do(func() {
+		namespace := namespaceOrDefault(s.MetricNamespace)
+		s.success = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "exporter", "collector_success"),
+				Help: "Whether the last run of a collector succeeded.",
+			},
+			[]string{
+				"collector",
+			},
+		)
+		s.duration = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "exporter", "collector_duration_seconds"),
+				Help: "Duration of the last run of a collector, in seconds.",
+			},
+			[]string{
+				"collector",
+			},
+		)
+	})
+}
+
+// record records a run of the named collector that started at start
+func (s *CollectorStatus) record(collector string, start time.Time, err error) {
+	s.init()
+
+	var success float64
+	if err == nil {
+		success = 1
+	}
+	s.success.WithLabelValues(collector).Set(success)
+	s.duration.WithLabelValues(collector).Set(time.Since(start).Seconds())
+}
+
+// Describe implements prometheus.Collector
+func (s *CollectorStatus) Describe(ch chan<- *prometheus.Desc) {
+	s.init()
+	s.success.Describe(ch)
+	s.duration.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (s *CollectorStatus) Collect(ch chan<- prometheus.Metric) {
+	s.init()
+	s.success.Collect(ch)
+	s.duration.Collect(ch)
+}
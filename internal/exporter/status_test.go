@@ -0,0 +1,104 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dtrack "github.com/DependencyTrack/client-go"
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollectorStatus(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// The status of the portfolio metrics endpoint
+		portfolioStatus int
+		wantErr         bool
+		want            map[string]float64
+	}{
+		{
+			name:            "portfolio error",
+			portfolioStatus: http.StatusInternalServerError,
+			wantErr:         true,
+			// The violation collector is disabled, so it isn't reported
+			want: map[string]float64{
+				"portfolio": 0,
+				"project":   1,
+			},
+		},
+		{
+			// A server without portfolio metrics is skipped, not failed
+			name:            "portfolio not found",
+			portfolioStatus: http.StatusNotFound,
+			want: map[string]float64{
+				"portfolio": 1,
+				"project":   1,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			// Mock version endpoint
+			mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(map[string]string{"version": "4.12.0"})
+			})
+
+			mux.HandleFunc("/api/v1/metrics/portfolio/current", func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, http.StatusText(tc.portfolioStatus), tc.portfolioStatus)
+			})
+
+			mux.HandleFunc("/api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Total-Count", "0")
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode([]dtrack.Project{})
+			})
+
+			client, err := dtrack.NewClient(server.URL)
+			if err != nil {
+				t.Fatalf("unexpected error setting up client: %s", err)
+			}
+
+			status := &CollectorStatus{}
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(status)
+
+			e := &Exporter{
+				Client:          client,
+				Logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+				Collectors:      []string{"portfolio", "project"},
+				CollectorStatus: status,
+			}
+			if err := e.poll(context.Background()); (err != nil) != tc.wantErr {
+				t.Fatalf("unexpected poll error: %v", err)
+			}
+
+			mfs, err := registry.Gather()
+			if err != nil {
+				t.Fatalf("unexpected error gathering metrics: %s", err)
+			}
+
+			got := make(map[string]float64)
+			for _, mf := range mfs {
+				if mf.GetName() != "dependency_track_exporter_collector_success" {
+					continue
+				}
+				for _, m := range mf.GetMetric() {
+					got[m.GetLabel()[0].GetValue()] = m.GetGauge().GetValue()
+				}
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("unexpected collector success (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// BearerTokenFileTransport is a http.RoundTripper that authenticates requests
+// with a bearer token read from a file. The file is read on every request so
+// that rotated tokens are picked up without a restart.
+type BearerTokenFileTransport struct {
+	TokenFile string
+	Transport http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *BearerTokenFileTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b, err := os.ReadFile(t.TokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading bearer token file: %w", err)
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return nil, fmt.Errorf("bearer token file %s is empty", t.TokenFile)
+	}
+
+	// RoundTrippers must not modify the original request
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return transportOrDefault(t.Transport).RoundTrip(req)
+}
+
+type retryAfterKey struct{}
+
+// withRetryAfter returns a context that RetryAfterTransport records the
+// Retry-After duration of a rate limited response into
+func withRetryAfter(ctx context.Context, retryAfter *time.Duration) context.Context {
+	return context.WithValue(ctx, retryAfterKey{}, retryAfter)
+}
+
+// RetryAfterTransport is a http.RoundTripper that records the Retry-After
+// header of 429 Too Many Requests responses, so that the exporter can wait for
+// as long as Dependency-Track asks before retrying. The client doesn't expose
+// response headers on errors, so this has to happen at the transport.
+type RetryAfterTransport struct {
+	Transport http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *RetryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := transportOrDefault(t.Transport).RoundTrip(req)
+	if err != nil || res.StatusCode != http.StatusTooManyRequests {
+		return res, err
+	}
+
+	if retryAfter, ok := req.Context().Value(retryAfterKey{}).(*time.Duration); ok {
+		*retryAfter = parseRetryAfter(res.Header.Get("Retry-After"))
+	}
+
+	return res, nil
+}
+
+// RateLimitTransport is a http.RoundTripper that records the remaining number
+// of requests reported in the rate limit headers of Dependency-Track, or a
+// reverse proxy in front of it. It's also a prometheus.Collector that exports
+// the last reported value, if any.
+type RateLimitTransport struct {
+	Transport http.RoundTripper
+	// MetricNamespace overrides the namespace of the exported metric, which
+	// defaults to Namespace
+	MetricNamespace string
+
+	mutex     sync.Mutex
+	remaining *float64
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *RateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := transportOrDefault(t.Transport).RoundTrip(req)
+	if err != nil {
+		return res, err
+	}
+
+	for _, header := range []string{"X-RateLimit-Remaining", "RateLimit-Remaining"} {
+		remaining, err := strconv.ParseFloat(res.Header.Get(header), 64)
+		if err != nil {
+			continue
+		}
+		t.mutex.Lock()
+		t.remaining = &remaining
+		t.mutex.Unlock()
+		break
+	}
+
+	return res, nil
+}
+
+func (t *RateLimitTransport) desc() *prometheus.Desc {
+	return prometheus.NewDesc(
+		prometheus.BuildFQName(namespaceOrDefault(t.MetricNamespace), "exporter", "rate_limit_remaining"),
+		"Number of requests remaining in the current rate limit window, as last reported by Dependency-Track.",
+		nil, nil,
+	)
+}
+
+// Describe implements prometheus.Collector
+func (t *RateLimitTransport) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.desc()
+}
+
+// Collect implements prometheus.Collector
+func (t *RateLimitTransport) Collect(ch chan<- prometheus.Metric) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.remaining == nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(t.desc(), prometheus.GaugeValue, *t.remaining)
+}
+
+// uuidPattern matches the UUIDs in request paths, which are replaced to keep the
+// cardinality of the path label bounded
+var uuidPattern = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+
+// InstrumentedTransport is a http.RoundTripper that records the number,
+// duration and response size of the requests made to Dependency-Track. It's
+// also a prometheus.Collector that exports them.
+type InstrumentedTransport struct {
+	Transport http.RoundTripper
+	// MetricNamespace overrides the namespace of the exported metrics, which
+	// defaults to Namespace
+	MetricNamespace string
+
+	once          sync.Once
+	requests      *prometheus.CounterVec
+	duration      *prometheus.HistogramVec
+	responseBytes *prometheus.SummaryVec
+}
+
+func (t *InstrumentedTransport) init() {
+	t.once.Do(func() {
+		namespace := namespaceOrDefault(t.MetricNamespace)
+		t.requests = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: prometheus.BuildFQName(namespace, "exporter", "http_requests_total"),
+				Help: "Number of HTTP requests made to Dependency-Track, by path and status code.",
+			},
+			[]string{
+				"path",
+				"code",
+			},
+		)
+		t.duration = prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    prometheus.BuildFQName(namespace, "exporter", "http_request_duration_seconds"),
+				Help:    "Duration of HTTP requests made to Dependency-Track, by path.",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{
+				"path",
+			},
+		)
+		t.responseBytes = prometheus.NewSummaryVec(
+			prometheus.SummaryOpts{
+				Name: prometheus.BuildFQName(namespace, "exporter", "api_response_bytes"),
+				Help: "Size of the bodies of the responses of Dependency-Track, by path.",
+			},
+			[]string{
+				"path",
+			},
+		)
+	})
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *InstrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.init()
+
+	start := time.Now()
+	res, err := transportOrDefault(t.Transport).RoundTrip(req)
+	path := uuidPattern.ReplaceAllString(req.URL.Path, ":uuid")
+	t.duration.WithLabelValues(path).Observe(time.Since(start).Seconds())
+
+	// Requests that failed without a response are recorded with an empty code
+	var code string
+	if err == nil {
+		code = strconv.Itoa(res.StatusCode)
+	}
+	t.requests.WithLabelValues(path, code).Inc()
+
+	// The body is streamed and often chunked, so its size is only known once
+	// it has been read
+	if err == nil {
+		res.Body = &countingReadCloser{
+			ReadCloser: res.Body,
+			observer:   t.responseBytes.WithLabelValues(path),
+		}
+	}
+
+	return res, err
+}
+
+// countingReadCloser counts the bytes read from a response body, and observes
+// the total when it's closed
+type countingReadCloser struct {
+	io.ReadCloser
+	observer prometheus.Observer
+	n        int
+	once     sync.Once
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += n
+	return n, err
+}
+
+func (r *countingReadCloser) Close() error {
+	r.once.Do(func() { r.observer.Observe(float64(r.n)) })
+	return r.ReadCloser.Close()
+}
+
+// Describe implements prometheus.Collector
+func (t *InstrumentedTransport) Describe(ch chan<- *prometheus.Desc) {
+	t.init()
+	t.requests.Describe(ch)
+	t.duration.Describe(ch)
+	t.responseBytes.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (t *InstrumentedTransport) Collect(ch chan<- prometheus.Metric) {
+	t.init()
+	t.requests.Collect(ch)
+	t.duration.Collect(ch)
+	t.responseBytes.Collect(ch)
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or a HTTP date. It returns 0 when the value is invalid.
+func parseRetryAfter(v string) time.Duration {
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+func namespaceOrDefault(namespace string) string {
+	if namespace == "" {
+		return Namespace
+	}
+	return namespace
+}
+
+func transportOrDefault(transport http.RoundTripper) http.RoundTripper {
+	if transport == nil {
+		return http.DefaultTransport
+	}
+	return transport
+}
@@ -0,0 +1,95 @@
+package exporter
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestBearerTokenFileTransport(t *testing.T) {
+	var gotAuthorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuthorization = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	client := &http.Client{
+		Transport: &BearerTokenFileTransport{TokenFile: tokenFile},
+	}
+
+	for _, token := range []string{"first", "rotated"} {
+		if err := os.WriteFile(tokenFile, []byte(token+"\n"), 0600); err != nil {
+			t.Fatalf("unexpected error writing token file: %s", err)
+		}
+
+		res, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("unexpected error sending request: %s", err)
+		}
+		res.Body.Close()
+
+		if want := "Bearer " + token; gotAuthorization != want {
+			t.Errorf("unexpected Authorization header: got %q, want %q", gotAuthorization, want)
+		}
+	}
+}
+
+func TestInstrumentedTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("not found"))
+	}))
+	defer server.Close()
+
+	transport := &InstrumentedTransport{}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(transport)
+	client := &http.Client{Transport: transport}
+
+	res, err := client.Get(server.URL + "/api/v1/project/0b7d1c5e-8d6c-4f3e-9a37-2f1d5b6a9c01")
+	if err != nil {
+		t.Fatalf("unexpected error sending request: %s", err)
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("unexpected error gathering metrics: %s", err)
+	}
+
+	var found, foundBytes bool
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			labels := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["path"] != "/api/v1/project/:uuid" {
+				continue
+			}
+			switch mf.GetName() {
+			case "dependency_track_exporter_http_requests_total":
+				if labels["code"] == "404" && m.GetCounter().GetValue() == 1 {
+					found = true
+				}
+			case "dependency_track_exporter_api_response_bytes":
+				if m.GetSummary().GetSampleCount() == 1 && m.GetSummary().GetSampleSum() == float64(len("not found")) {
+					foundBytes = true
+				}
+			}
+		}
+	}
+	if !found {
+		t.Errorf("expected the request to be recorded, got: %v", mfs)
+	}
+	if !foundBytes {
+		t.Errorf("expected the response size to be recorded, got: %v", mfs)
+	}
+}
@@ -2,19 +2,27 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"path"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/1azunna/dependency-track-exporter/internal/exporter"
 	dtrack "github.com/DependencyTrack/client-go"
 	"github.com/alecthomas/kingpin/v2"
+	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
+	versioncollector "github.com/prometheus/client_golang/prometheus/collectors/version"
 	"github.com/prometheus/common/promslog"
 	"github.com/prometheus/common/promslog/flag"
 	"github.com/prometheus/common/version"
@@ -23,8 +31,9 @@ import (
 )
 
 const (
-	envAddress string = "DEPENDENCY_TRACK_ADDR"
-	envAPIKey  string = "DEPENDENCY_TRACK_API_KEY"
+	envAddress     string = "DEPENDENCY_TRACK_ADDR"
+	envAPIKey      string = "DEPENDENCY_TRACK_API_KEY"
+	envBearerToken string = "DEPENDENCY_TRACK_BEARER_TOKEN"
 )
 
 func init() {
@@ -33,34 +42,259 @@ func init() {
 
 func main() {
 	var (
+		_                            = kingpin.Flag(configFileFlag, "Path to a YAML file setting any of the other flags, keyed by flag name. Flags and environment variables take precedence").String()
 		webConfig                    = webflag.AddFlags(kingpin.CommandLine, ":9916")
 		metricsPath                  = kingpin.Flag("web.metrics-path", "Path under which to expose metrics").Default("/metrics").String()
+		maxRequests                  = kingpin.Flag("web.max-requests", "Maximum number of parallel scrape requests. Use 0 to disable.").Default("40").Int()
+		enableDebug                  = kingpin.Flag("web.enable-debug", "Expose the responses of Dependency-Track recorded by the latest poll under <web.metrics-path>/debug. They may contain sensitive project data").Bool()
+		enableRefresh                = kingpin.Flag("web.enable-refresh", "Expose a /refresh endpoint that polls Dependency-Track immediately on POST requests").Bool()
+		enableProbe                  = kingpin.Flag("web.enable-probe", "Expose a /probe endpoint that collects the metrics of a single project on demand. Concurrent probes are limited by --web.max-requests").Bool()
+		refreshMinInterval           = kingpin.Flag("web.refresh-min-interval", "Minimum time between two refreshes requested through /refresh").Default("1m").Duration()
+		shutdownTimeout              = kingpin.Flag("web.shutdown-timeout", "Maximum time to wait for in-flight scrapes to complete on shutdown").Default("30s").Duration()
 		dtAddress                    = kingpin.Flag("dtrack.address", fmt.Sprintf("Dependency-Track server address (can also be set with $%s)", envAddress)).Default("http://localhost:8080").Envar(envAddress).String()
-		dtAPIKey                     = kingpin.Flag("dtrack.api-key", fmt.Sprintf("Dependency-Track API key (can also be set with $%s)", envAPIKey)).Envar(envAPIKey).Required().String()
-		dtProjectTags                = kingpin.Flag("dtrack.project-tags", "Comma-separated list of project tags to filter on").String()
+		dtAPIKey                     = kingpin.Flag("dtrack.api-key", fmt.Sprintf("Dependency-Track API key (can also be set with $%s)", envAPIKey)).Envar(envAPIKey).String()
+		dtBearerToken                = kingpin.Flag("dtrack.bearer-token", fmt.Sprintf("Dependency-Track bearer token, used instead of an API key (can also be set with $%s)", envBearerToken)).Envar(envBearerToken).String()
+		dtBearerTokenFile            = kingpin.Flag("dtrack.bearer-token-file", "File containing a Dependency-Track bearer token, re-read on every request").String()
+		dtMaxIdleConns               = kingpin.Flag("dtrack.max-idle-conns", "Maximum number of idle connections kept open to Dependency-Track").Default("100").Int()
+		dtProxyURL                   = kingpin.Flag("dtrack.proxy-url", "URL of an HTTP, HTTPS or SOCKS5 proxy to send requests to Dependency-Track through. Defaults to the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables").String()
+		dtTLSCertFile                = kingpin.Flag("dtrack.tls-cert-file", "Path to a client certificate to present to Dependency-Track, for mutual TLS. Requires dtrack.tls-key-file").String()
+		dtTLSKeyFile                 = kingpin.Flag("dtrack.tls-key-file", "Path to the private key of the client certificate. Requires dtrack.tls-cert-file").String()
+		dtMaxConnsPerHost            = kingpin.Flag("dtrack.max-conns-per-host", "Maximum number of connections to Dependency-Track. Use 0 to disable.").Default("0").Int()
+		dtUserAgent                  = kingpin.Flag("dtrack.user-agent", "User-Agent header sent to Dependency-Track").Default("dependency-track-exporter/" + version.Version).String()
+		dtProjectTags                = kingpin.Flag("dtrack.project-tags", "Comma-separated list of project tags to filter on. ${VAR} references are expanded from the environment").String()
+		dtProjectClassifiers         = kingpin.Flag("dtrack.project-classifiers", "Comma-separated list of project classifiers to filter on (e.g. APPLICATION,LIBRARY)").String()
+		dtOnlyProjectsWithViolations = kingpin.Flag("dtrack.only-projects-with-violations", "Only collect metrics for projects with at least one policy violation or vulnerability").Bool()
+		dtProjectUUIDs               = kingpin.Flag("dtrack.project-uuids", "Comma-separated list of UUIDs of projects to collect metrics for. The projects are fetched directly instead of listing the portfolio").String()
 		pollInterval                 = kingpin.Flag("dtrack.poll-interval", "Interval to poll Dependency-Track for metrics").Default("6h").Duration()
+		dtNoPoll                     = kingpin.Flag("dtrack.no-poll", "Serve the HTTP endpoints without polling Dependency-Track in the background, for testing").Bool()
+		dtPortfolioPollInterval      = kingpin.Flag("dtrack.portfolio-poll-interval", "Interval to poll Dependency-Track for portfolio metrics. Defaults to --dtrack.poll-interval").Default("0").Duration()
+		dtProjectPollInterval        = kingpin.Flag("dtrack.project-poll-interval", "Interval to poll Dependency-Track for project, violation and policy metrics. Defaults to --dtrack.poll-interval").Default("0").Duration()
+		dtStartupTimeout             = kingpin.Flag("dtrack.startup-timeout", "How long to retry a failed initial poll for, with exponential backoff, before waiting for the next poll interval. Use 0 to disable retries").Default("5m").Duration()
+		dtPollJitter                 = kingpin.Flag("dtrack.poll-jitter", "Maximum random delay before the initial poll, to spread the load of replicas started at the same time").Default("0").Duration()
+		dtMaxProjects                = kingpin.Flag("dtrack.max-projects", "Maximum number of projects to collect metrics for. Use 0 to disable.").Default("0").Int()
+		dtCollectors                 = kingpin.Flag("dtrack.collectors", "Comma-separated list of metric groups to collect, from: "+strings.Join(exporter.Collectors, ",")).Default(strings.Join(exporter.Collectors, ",")).String()
+		dtSkipPortfolioMetrics       = kingpin.Flag("dtrack.skip-portfolio-metrics", "Skip the portfolio metrics, equivalent to removing portfolio from dtrack.collectors").Bool()
+		dtMetricsMaxAge              = kingpin.Flag("dtrack.metrics-max-age", "Maximum age of the metrics Dependency-Track computed for a project before it's reported as stale. Use 0 to disable.").Default("0").Duration()
+		dtStaleBOMThreshold          = kingpin.Flag("dtrack.stale-bom-threshold", "Maximum age of the last BOM import of a project before it's reported as stale. Use 0 to disable.").Default("0").Duration()
+		dtMaxDataAge                 = kingpin.Flag("dtrack.max-data-age", "Respond with a 503 when there hasn't been a successful poll for this long. Use 0 to disable.").Default("0").Duration()
+		dtRefreshStrategy            = kingpin.Flag("dtrack.refresh-strategy", "How findings are refreshed. One of: [full, incremental]").Default("full").Enum("full", "incremental")
+		dtRefreshShards              = kingpin.Flag("dtrack.refresh-shards", "Number of shards projects are split into with the incremental refresh strategy").Default("4").Int()
+		dtPageSize                   = kingpin.Flag("dtrack.page-size", "Number of items to request per page from Dependency-Track").Default("50").Int()
 		dtInitializeViolationMetrics = kingpin.Flag("dtrack.initialize-violation-metrics", "Initialize all possible violation metric combinations to 0").Default("true").String()
+		dtProjectInfoLabels          = kingpin.Flag("dtrack.project-info-labels", "Comma-separated list of labels to add to dependency_track_project_info").Default(strings.Join(exporter.DefaultProjectInfoLabels, ",")).String()
+		dtCollectFindings            = kingpin.Flag("dtrack.collect-findings", "Collect individual findings for every project. This requires an additional API call per project").Bool()
+		dtCollectFindingsBySource    = kingpin.Flag("dtrack.collect-findings-by-source", "Collect the number of findings by vulnerability source. This requires an additional API call per project").Bool()
+		dtCollectVulnsDetailed       = kingpin.Flag("dtrack.collect-vulnerabilities-detailed", "Collect the number of vulnerabilities for every project by severity and analysis state. This requires an additional API call per project").Bool()
+		dtFindingAgeBuckets          = kingpin.Flag("dtrack.finding-age-buckets", "Comma-separated list of upper bounds of the buckets findings are counted in by age, in increasing order").Default("168h,720h,2160h").String()
+		dtCollectAffectedProjects    = kingpin.Flag("dtrack.collect-affected-projects", "Collect the number of projects affected by every vulnerability. This requires an additional API call per project").Bool()
+		dtAffectedProjectsLimit      = kingpin.Flag("dtrack.affected-projects-limit", "Maximum number of vulnerabilities to report the affected projects of, keeping those affecting the most projects. Use 0 to disable.").Default("0").Int()
+		dtCollectComponents          = kingpin.Flag("dtrack.collect-components", "Collect the number of components of every project by type. This requires an additional API call per project").Bool()
+		dtCollectLicenses            = kingpin.Flag("dtrack.collect-licenses", "Collect the number of components using every license across the matched projects. This requires an additional API call per project").Bool()
+		dtRefreshMetrics             = kingpin.Flag("dtrack.refresh-metrics", "Ask Dependency-Track to recompute the metrics of every project during a poll, so that the next poll reads fresh values. This requires an additional API call per project").Bool()
+		dtIncludeSuppressedFindings  = kingpin.Flag("dtrack.include-suppressed-findings", "Include suppressed findings when collecting findings").Bool()
+		dtSuppressedRecentWindow     = kingpin.Flag("dtrack.findings-suppressed-recent-window", "Count the findings of every project suppressed within this window. Requires --dtrack.collect-findings and --dtrack.include-suppressed-findings, and an additional API call per suppressed finding. Use 0 to disable").Default("0").Duration()
+		dtCollectPolicies            = kingpin.Flag("dtrack.collect-policies", "Collect metrics about the configured policies").Bool()
+		dtCollectProjectTags         = kingpin.Flag("dtrack.collect-project-tags", "Export a dependency_track_project_tag series for every tag of a project").Bool()
+		dtAggregateTags              = kingpin.Flag("dtrack.aggregate-tags", "Comma-separated list of tags to export vulnerability counts summed across all the projects with the tag for").String()
+		dtTagLabelMap                = kingpin.Flag("dtrack.tag-label-map", "Comma-separated list of keys of key:value project tags to add as labels to dependency_track_project_info").String()
+		dtViolationStates            = kingpin.Flag("dtrack.violation-states", "Comma-separated list of states of the policy violations to collect, from: "+strings.Join(exporter.ViolationStates, ",")+". All are collected when empty").String()
+		dtProjectLabels              = kingpin.Flag("dtrack.project-labels", "Labels identifying a project on its vulnerability, policy violation, last BOM import and risk score metrics. One of: [all, uuid-only]").Default("all").Enum("all", "uuid-only")
+		dtIncludeIdentifiers         = kingpin.Flag("dtrack.include-identifiers", "Add the package URL, CPE and SWID tag ID of projects as labels on dependency_track_project_info").Bool()
+		dtIncludeParentLabels        = kingpin.Flag("dtrack.include-parent-labels", "Add the parent project UUID as a label on dependency_track_project_info").Bool()
+		dtOutputFile                 = kingpin.Flag("dtrack.output-file", "Path of a file to write the metrics to after every successful poll, in the Prometheus text format, for the textfile collector of the node exporter").String()
+		dtPushGateway                = kingpin.Flag("dtrack.push-gateway", "URL of a Pushgateway to push the metrics to after every successful poll").String()
+		dtPushJob                    = kingpin.Flag("dtrack.push-job", "Job name to push the metrics under").Default("dependency_track_exporter").String()
+		dtPushGrouping               = kingpin.Flag("dtrack.push-grouping", "Grouping label to push the metrics under, in the form name=value. Can be repeated").StringMap()
+		metricNamespace              = kingpin.Flag("metric.namespace", "Namespace of the exported metrics").Default(exporter.Namespace).String()
+		dryRun                       = kingpin.Flag("dry-run", "Poll Dependency-Track once, write the collected metrics to stdout and exit").Bool()
 		promslogConfig               = promslog.Config{}
 	)
 
 	flag.AddFlags(kingpin.CommandLine, &promslogConfig)
 	kingpin.Version(version.Print(exporter.Namespace + "_exporter"))
 	kingpin.HelpFlag.Short('h')
+	if path := configFilePath(kingpin.CommandLine, os.Args[1:]); path != "" {
+		if err := loadConfigFile(kingpin.CommandLine, path); err != nil {
+			kingpin.Fatalf("Error loading config file: %s", err)
+		}
+	}
 	kingpin.Parse()
 
 	logger := promslog.New(&promslogConfig)
 
 	logger.Info("Starting exporter", "namespace", exporter.Namespace, "version", version.Info(), "build_context", version.BuildContext())
 
-	c, err := dtrack.NewClient(*dtAddress, dtrack.WithAPIKey(*dtAPIKey))
+	if err := exporter.ValidateMetricNamespace(*metricNamespace); err != nil {
+		logger.Error("Error parsing metric.namespace", "err", err)
+		os.Exit(1)
+	}
+
+	// All requests go to the same host, so every idle connection may be kept
+	// for it, rather than the default of 2
+	pooled := http.DefaultTransport.(*http.Transport).Clone()
+	pooled.MaxIdleConns = *dtMaxIdleConns
+	pooled.MaxIdleConnsPerHost = *dtMaxIdleConns
+	pooled.MaxConnsPerHost = *dtMaxConnsPerHost
+
+	tlsConfig, err := clientTLSConfig(*dtTLSCertFile, *dtTLSKeyFile)
+	if err != nil {
+		logger.Error("Error loading the client certificate", "err", err)
+		os.Exit(1)
+	}
+	if tlsConfig != nil {
+		pooled.TLSClientConfig = tlsConfig
+	}
+
+	proxy, err := proxyFunc(*dtProxyURL)
 	if err != nil {
-		logger.Error("Error creating client", "err", err)
+		logger.Error("Error parsing dtrack.proxy-url", "err", err)
+		os.Exit(1)
+	}
+	pooled.Proxy = proxy
+
+	var (
+		instrumented                   = &exporter.InstrumentedTransport{Transport: pooled, MetricNamespace: *metricNamespace}
+		rateLimit                      = &exporter.RateLimitTransport{Transport: instrumented, MetricNamespace: *metricNamespace}
+		transport    http.RoundTripper = &exporter.RetryAfterTransport{Transport: rateLimit}
+		authOptions  []dtrack.ClientOption
+		status       = &exporter.CollectorStatus{MetricNamespace: *metricNamespace}
+	)
+	// The default registry, which also holds the Go runtime and process
+	// collectors, is served alongside the registry of each poll
+	prometheus.MustRegister(
+		versioncollector.NewCollector(*metricNamespace+"_exporter"),
+		instrumented,
+		rateLimit,
+		status,
+	)
+	switch {
+	case countSet(*dtAPIKey, *dtBearerToken, *dtBearerTokenFile) != 1:
+		logger.Error("Exactly one of dtrack.api-key, dtrack.bearer-token or dtrack.bearer-token-file must be set")
+		os.Exit(1)
+	case *dtAPIKey != "":
+		authOptions = append(authOptions, dtrack.WithAPIKey(*dtAPIKey))
+	case *dtBearerToken != "":
+		authOptions = append(authOptions, dtrack.WithBearerToken(*dtBearerToken))
+	case *dtBearerTokenFile != "":
+		transport = &exporter.BearerTokenFileTransport{
+			TokenFile: *dtBearerTokenFile,
+			Transport: transport,
+		}
+	}
+
+	// The HTTP client must be set before the auth options, which wrap its transport
+	clientOptions := append([]dtrack.ClientOption{
+		dtrack.WithHttpClient(&http.Client{
+			Timeout:   dtrack.DefaultTimeout,
+			Transport: transport,
+		}),
+		dtrack.WithUserAgent(*dtUserAgent),
+	}, authOptions...)
+
+	// Creating the client requires Dependency-Track to be up, so it's left to
+	// the first poll, which is retried for dtrack.startup-timeout. Only the
+	// address is checked here.
+	if _, err := url.ParseRequestURI(*dtAddress); err != nil {
+		logger.Error("Error parsing dtrack.address", "err", err)
 		os.Exit(1)
 	}
+	newClient := func() (*dtrack.Client, error) {
+		return dtrack.NewClient(*dtAddress, clientOptions...)
+	}
 
+	// Tags are expanded once at startup, so that deployments can derive them
+	// from the environment
 	var projectTags []string
-	if *dtProjectTags != "" {
-		projectTags = strings.Split(*dtProjectTags, ",")
+	if tags := os.Expand(*dtProjectTags, os.Getenv); tags != "" {
+		projectTags = strings.Split(tags, ",")
+	}
+
+	var projectClassifiers []string
+	if *dtProjectClassifiers != "" {
+		projectClassifiers = strings.Split(*dtProjectClassifiers, ",")
+	}
+
+	var projectUUIDs []uuid.UUID
+	if *dtProjectUUIDs != "" {
+		for _, s := range strings.Split(*dtProjectUUIDs, ",") {
+			id, err := uuid.Parse(s)
+			if err != nil {
+				logger.Error("Error parsing dtrack.project-uuids", "err", err)
+				os.Exit(1)
+			}
+			projectUUIDs = append(projectUUIDs, id)
+		}
+	}
+
+	var refreshShards int
+	if *dtRefreshStrategy == "incremental" {
+		if *dtRefreshShards < 1 {
+			logger.Error("Error parsing dtrack.refresh-shards", "err", "number of shards must be at least 1")
+			os.Exit(1)
+		}
+		refreshShards = *dtRefreshShards
+	}
+
+	if *dtPageSize < 1 {
+		logger.Error("Error parsing dtrack.page-size", "err", "page size must be at least 1")
+		os.Exit(1)
+	}
+
+	collectors := strings.Split(*dtCollectors, ",")
+	if err := exporter.ValidateCollectors(collectors); err != nil {
+		logger.Error("Error parsing dtrack.collectors", "err", err)
+		os.Exit(1)
+	}
+	if *dtSkipPortfolioMetrics {
+		collectors = slices.DeleteFunc(collectors, func(name string) bool { return name == "portfolio" })
+		// The exporter runs every collector when none are configured
+		if len(collectors) == 0 {
+			logger.Error("Error parsing dtrack.skip-portfolio-metrics", "err", "no collectors are left once the portfolio metrics are skipped")
+			os.Exit(1)
+		}
+	}
+
+	projectInfoLabels := strings.Split(*dtProjectInfoLabels, ",")
+	if err := exporter.ValidateProjectInfoLabels(projectInfoLabels); err != nil {
+		logger.Error("Error parsing dtrack.project-info-labels", "err", err)
+		os.Exit(1)
+	}
+
+	var tagLabels []string
+	if *dtTagLabelMap != "" {
+		tagLabels = strings.Split(*dtTagLabelMap, ",")
+	}
+	if err := exporter.ValidateTagLabels(tagLabels); err != nil {
+		logger.Error("Error parsing dtrack.tag-label-map", "err", err)
+		os.Exit(1)
+	}
+
+	var findingAgeBuckets []time.Duration
+	for _, s := range strings.Split(*dtFindingAgeBuckets, ",") {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			logger.Error("Error parsing dtrack.finding-age-buckets", "err", err)
+			os.Exit(1)
+		}
+		findingAgeBuckets = append(findingAgeBuckets, d)
+	}
+	if err := exporter.ValidateFindingAgeBuckets(findingAgeBuckets); err != nil {
+		logger.Error("Error parsing dtrack.finding-age-buckets", "err", err)
+		os.Exit(1)
+	}
+
+	var violationStates []string
+	if *dtViolationStates != "" {
+		violationStates = strings.Split(*dtViolationStates, ",")
+	}
+	if err := exporter.ValidateViolationStates(violationStates); err != nil {
+		logger.Error("Error parsing dtrack.violation-states", "err", err)
+		os.Exit(1)
+	}
+
+	var aggregateTags []string
+	if *dtAggregateTags != "" {
+		aggregateTags = strings.Split(*dtAggregateTags, ",")
 	}
 
 	initViolationMetrics, err := strconv.ParseBool(*dtInitializeViolationMetrics)
@@ -70,34 +304,89 @@ func main() {
 	}
 
 	e := exporter.Exporter{
-		Client:                     c,
-		Logger:                     logger,
-		ProjectTags:                projectTags,
-		InitializeViolationMetrics: initViolationMetrics,
+		NewClient:                      newClient,
+		Logger:                         logger,
+		ProjectTags:                    projectTags,
+		ProjectClassifiers:             projectClassifiers,
+		OnlyProjectsWithViolations:     *dtOnlyProjectsWithViolations,
+		ProjectUUIDs:                   projectUUIDs,
+		ProjectInfoLabels:              projectInfoLabels,
+		Collectors:                     collectors,
+		TagLabels:                      tagLabels,
+		AggregateTags:                  aggregateTags,
+		InitializeViolationMetrics:     initViolationMetrics,
+		IncludeParentLabels:            *dtIncludeParentLabels,
+		IncludeIdentifiers:             *dtIncludeIdentifiers,
+		FindingAgeBuckets:              findingAgeBuckets,
+		ViolationStates:                violationStates,
+		UUIDOnlyLabels:                 *dtProjectLabels == "uuid-only",
+		CollectFindings:                *dtCollectFindings,
+		CollectFindingsBySource:        *dtCollectFindingsBySource,
+		CollectVulnerabilitiesDetailed: *dtCollectVulnsDetailed,
+		CollectAffectedProjects:        *dtCollectAffectedProjects,
+		CollectComponents:              *dtCollectComponents,
+		CollectLicenses:                *dtCollectLicenses,
+		RefreshMetrics:                 *dtRefreshMetrics,
+		AffectedProjectsLimit:          *dtAffectedProjectsLimit,
+		IncludeSuppressedFindings:      *dtIncludeSuppressedFindings,
+		RecentSuppressionWindow:        *dtSuppressedRecentWindow,
+		CollectPolicies:                *dtCollectPolicies,
+		CollectProjectTags:             *dtCollectProjectTags,
+		MaxProjects:                    *dtMaxProjects,
+		MetricsMaxAge:                  *dtMetricsMaxAge,
+		StaleBOMThreshold:              *dtStaleBOMThreshold,
+		PageSize:                       *dtPageSize,
+		MaxRequestsInFlight:            *maxRequests,
+		MaxDataAge:                     *dtMaxDataAge,
+		RefreshShards:                  refreshShards,
+		MetricNamespace:                *metricNamespace,
+		PollJitter:                     *dtPollJitter,
+		StartupTimeout:                 *dtStartupTimeout,
+		PortfolioPollInterval:          *dtPortfolioPollInterval,
+		ProjectPollInterval:            *dtProjectPollInterval,
+		OutputFile:                     *dtOutputFile,
+		PushGateway:                    *dtPushGateway,
+		PushJob:                        *dtPushJob,
+		PushGrouping:                   *dtPushGrouping,
+		Debug:                          *enableDebug,
+		RefreshMinInterval:             *refreshMinInterval,
+		CollectorStatus:                status,
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	go e.Run(ctx, *pollInterval)
+	if *dryRun {
+		if err := e.DryRun(ctx, os.Stdout); err != nil {
+			logger.Error("Error polling Dependency-Track", "err", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 
-	http.HandleFunc(*metricsPath, e.HandlerFunc())
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		_, _ = w.Write([]byte(`<html>
-						 <head><title>Dependency-Track Exporter</title></head>
-						 <body>
-						 <h1>Dependency-Track Exporter</h1>
-						 <p><a href='` + *metricsPath + `'>Metrics</a></p>
-						 </body>
-						 </html>`))
-	})
+	pollerDone := make(chan struct{})
+	if *dtNoPoll {
+		// The metrics endpoint reports the exporter as initializing until a
+		// poll is triggered otherwise
+		logger.Info("Background poller disabled")
+		close(pollerDone)
+	} else {
+		go func() {
+			defer close(pollerDone)
+			e.Run(ctx, *pollInterval)
+		}()
+	}
 
 	srvc := make(chan struct{})
 	term := make(chan os.Signal, 1)
 	signal.Notify(term, os.Interrupt, syscall.SIGTERM)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 
+	srv := &http.Server{
+		Handler: withRequestLogging(logger, newServeMux(&e, *metricsPath, *enableDebug, *enableRefresh, *enableProbe)),
+	}
 	go func() {
-		srv := &http.Server{}
 		if err := web.ListenAndServe(srv, webConfig, logger); err != http.ErrServerClosed {
 			logger.Error("Error starting HTTP server", "err", err)
 			close(srvc)
@@ -108,9 +397,124 @@ func main() {
 		select {
 		case <-term:
 			logger.Info("Received SIGTERM, exiting gracefully...")
-			os.Exit(0)
+			os.Exit(shutdown(srv, cancel, pollerDone, *shutdownTimeout, logger))
+		case <-hup:
+			// The web toolkit reads the web config and TLS certificates on
+			// every new connection, so there's nothing to swap in here. Validate
+			// the config so that operators find out about a bad rotation from
+			// the reload rather than from failing handshakes.
+			if err := web.Validate(*webConfig.WebConfigFile); err != nil {
+				logger.Error("Error reloading web config", "err", err)
+				continue
+			}
+			logger.Info("Reloaded web config")
 		case <-srvc:
 			os.Exit(1)
 		}
 	}
 }
+
+// newServeMux returns the handler of every endpoint of the exporter. It's
+// served by the web toolkit, which applies the TLS and authentication settings
+// of the web config file to all of them.
+func newServeMux(e *exporter.Exporter, metricsPath string, enableDebug, enableRefresh, enableProbe bool) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc(metricsPath, e.HandlerFunc())
+	if enableProbe {
+		mux.HandleFunc("/probe", e.ProbeHandlerFunc())
+	}
+	if enableDebug {
+		mux.HandleFunc(path.Join(metricsPath, "debug"), e.DebugHandlerFunc())
+	}
+	if enableRefresh {
+		mux.HandleFunc("/refresh", e.RefreshHandlerFunc())
+	}
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<html>
+						 <head><title>Dependency-Track Exporter</title></head>
+						 <body>
+						 <h1>Dependency-Track Exporter</h1>
+						 <p><a href='` + metricsPath + `'>Metrics</a></p>
+						 </body>
+						 </html>`))
+	})
+	return mux
+}
+
+// shutdown cancels the poller and stops the HTTP server, waiting up to timeout
+// for in-flight scrapes to complete and the poller to return. It returns the
+// exit code for the process.
+func shutdown(srv *http.Server, cancel context.CancelFunc, pollerDone <-chan struct{}, timeout time.Duration, logger *slog.Logger) int {
+	code := 0
+
+	// Scrapes are served from the latest completed poll, so an in-flight poll
+	// can be cancelled straight away, which aborts its pending requests
+	cancel()
+
+	ctx, cancelShutdown := context.WithTimeout(context.Background(), timeout)
+	defer cancelShutdown()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Error("Error shutting down HTTP server", "err", err)
+		code = 1
+	}
+
+	select {
+	case <-pollerDone:
+	case <-ctx.Done():
+		logger.Error("Timed out waiting for the background poller to stop")
+		code = 1
+	}
+
+	return code
+}
+
+// clientTLSConfig returns a TLS config presenting the given client certificate,
+// or nil when neither file is set
+func clientTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	switch countSet(certFile, keyFile) {
+	case 0:
+		return nil, nil
+	case 1:
+		return nil, fmt.Errorf("both dtrack.tls-cert-file and dtrack.tls-key-file must be set")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// proxyFunc returns the proxy function of the transport of the client, which
+// sends every request through proxyURL, or through the proxy configured in the
+// environment when it's empty
+func proxyFunc(proxyURL string) (func(*http.Request) (*url.URL, error), error) {
+	if proxyURL == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	return http.ProxyURL(u), nil
+}
+
+// countSet returns the number of non-empty values
+func countSet(values ...string) int {
+	var n int
+	for _, v := range values {
+		if v != "" {
+			n++
+		}
+	}
+	return n
+}
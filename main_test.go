@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/1azunna/dependency-track-exporter/internal/exporter"
+	dtrack "github.com/DependencyTrack/client-go"
+	"github.com/prometheus/exporter-toolkit/web"
+)
+
+func TestServeMux_BasicAuth(t *testing.T) {
+	// The password is "secret"
+	webConfigPath := filepath.Join(t.TempDir(), "web-config.yml")
+	webConfig := `
+basic_auth_users:
+  admin: $2a$04$TSiylpNq0Elqe0ZxhNcNxuhRFejdgZ5bZ7ekom.FKW/QUoF/6z3US
+`
+	if err := os.WriteFile(webConfigPath, []byte(webConfig), 0600); err != nil {
+		t.Fatalf("unexpected error writing web config file: %s", err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error listening: %s", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	e := &exporter.Exporter{Logger: logger}
+	srv := &http.Server{Handler: newServeMux(e, "/metrics", true, true, true)}
+	defer srv.Close()
+	systemdSocket := false
+	go func() {
+		_ = web.Serve(l, srv, &web.FlagConfig{
+			WebListenAddresses: &[]string{},
+			WebSystemdSocket:   &systemdSocket,
+			WebConfigFile:      &webConfigPath,
+		}, logger)
+	}()
+
+	for _, path := range []string{"/metrics", "/metrics/debug", "/probe", "/refresh", "/"} {
+		resp, err := http.Get("http://" + l.Addr().String() + path)
+		if err != nil {
+			t.Fatalf("unexpected error requesting %s: %s", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("unexpected status code for unauthenticated request to %s: got %d, want %d", path, resp.StatusCode, http.StatusUnauthorized)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+l.Addr().String()+"/metrics", nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %s", err)
+	}
+	req.SetBasicAuth("admin", "secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error requesting /metrics: %s", err)
+	}
+	resp.Body.Close()
+	// The exporter hasn't polled yet, but the request got past authentication
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("unexpected status code for authenticated request: got %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+}
+
+func TestServeMux_WithoutDependencyTrack(t *testing.T) {
+	// As with --dtrack.no-poll, the exporter serves its endpoints before it
+	// ever polls, and Dependency-Track is unreachable
+	var connections int
+	e := &exporter.Exporter{
+		NewClient: func() (*dtrack.Client, error) {
+			connections++
+			return nil, errors.New("connection refused")
+		},
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	mux := newServeMux(e, "/metrics", true, true, true)
+
+	for path, want := range map[string]int{
+		"/metrics":       http.StatusServiceUnavailable,
+		"/metrics/debug": http.StatusServiceUnavailable,
+		"/":              http.StatusOK,
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Errorf("unexpected status code for %s: got %d, want %d", path, rec.Code, want)
+		}
+	}
+	if connections != 0 {
+		t.Errorf("unexpected connections to Dependency-Track: got %d, want 0", connections)
+	}
+}
+
+func TestClientTLSConfig(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "dependency-track-exporter"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unexpected error creating certificate: %s", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("unexpected error marshalling key: %s", err)
+	}
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("unexpected error writing certificate: %s", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("unexpected error writing key: %s", err)
+	}
+
+	cfg, err := clientTLSConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("unexpected error loading client certificate: %s", err)
+	}
+	if len(cfg.Certificates) != 1 {
+		t.Fatalf("unexpected number of certificates: got %d, want 1", len(cfg.Certificates))
+	}
+	if !bytes.Equal(cfg.Certificates[0].Certificate[0], der) {
+		t.Error("expected the loaded certificate to match the certificate file")
+	}
+
+	if cfg, err := clientTLSConfig("", ""); err != nil || cfg != nil {
+		t.Errorf("expected no TLS config without files, got %v, %v", cfg, err)
+	}
+	if _, err := clientTLSConfig(certFile, ""); err == nil {
+		t.Error("expected an error when the key file is missing")
+	}
+}
+
+func TestProxyFunc(t *testing.T) {
+	// A forward proxy receives the absolute URL of the requests it proxies
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	f, err := proxyFunc(proxy.URL)
+	if err != nil {
+		t.Fatalf("unexpected error parsing the proxy URL: %s", err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = f
+	resp, err := (&http.Client{Transport: transport}).Get("http://dtrack.invalid/api/version")
+	if err != nil {
+		t.Fatalf("unexpected error sending request: %s", err)
+	}
+	resp.Body.Close()
+	if want := "http://dtrack.invalid/api/version"; proxied != want {
+		t.Errorf("unexpected proxied request: got %q, want %q", proxied, want)
+	}
+
+	// Without a proxy URL, the environment is used
+	f, err = proxyFunc("")
+	if err != nil {
+		t.Fatalf("unexpected error without a proxy URL: %s", err)
+	}
+	if reflect.ValueOf(f).Pointer() != reflect.ValueOf(http.ProxyFromEnvironment).Pointer() {
+		t.Error("expected the proxy to be read from the environment")
+	}
+
+	if _, err := proxyFunc("ftp://proxy.example.com"); err == nil {
+		t.Error("expected an error for an unsupported proxy scheme")
+	}
+}